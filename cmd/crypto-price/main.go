@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -17,12 +21,25 @@ var flags = struct {
 	Satoshi                   bool
 	Polybar                   bool
 	PolybarShortOnlyOnWeekend bool
+	PolybarSparkline          int
 	Waybar                    bool
 	WaybarShortOnlyOnWeekend  bool
+	WaybarJSON                bool
+	WaybarSparkline           int
+	SparklineWindow           time.Duration
 	JSON                      bool
 	Server                    bool
 	Debug                     bool
 	Alert                     bool
+	Record                    string
+	Store                     bool
+	StoreDir                  string
+	StoreRetention            time.Duration
+	Replay                    string
+	ReplaySpeed               float64
+	StallTimeout              time.Duration
+	Connectivity              string
+	ConnectivityTargets       []string
 }{}
 
 // rootCmd represents the base command when called without any subcommands
@@ -40,15 +57,28 @@ var rootCmd = &cobra.Command{
 
 		aggregator := exchange.NewAggregator(exchange.Options{
 			ConvertToSatoshi: flags.Satoshi,
+			StallTimeout:     flags.StallTimeout,
 		})
 
+		checker, err := exchange.NewConnectivityChecker(flags.Connectivity, flags.ConnectivityTargets, aggregator)
+		if err != nil {
+			logrus.WithError(err).Fatal("connectivity checker error")
+		}
+		aggregator.SetConnectivityChecker(checker)
+
+		if flags.Replay != "" {
+			aggregator.AddExchange("replay", func() exchange.Exchange {
+				return exchange.NewReplay(flags.Replay, flags.ReplaySpeed)
+			})
+		}
+
 		observers := []exchange.Observer{}
 
 		if flags.JSON {
 			observers = append(observers, observer.NewJSONOutput())
 		}
 		if flags.Server {
-			observers = append(observers, observer.NewMarketAPIServer())
+			observers = append(observers, observer.NewMarketAPIServer(aggregator))
 		}
 		if flags.Template != "" {
 			observers = append(observers, observer.NewTemplateOutput(flags.Template))
@@ -56,11 +86,16 @@ var rootCmd = &cobra.Command{
 		if flags.Polybar {
 			observers = append(observers, observer.NewPolybarOutput(observer.PolybarConfig{
 				ShortOnlyOnWeekend: flags.PolybarShortOnlyOnWeekend,
+				Sparkline:          flags.PolybarSparkline,
+				SparklineWindow:    flags.SparklineWindow,
 			}))
 		}
 		if flags.Waybar {
 			observers = append(observers, observer.NewWaybarOutput(observer.WaybarConfig{
 				ShortOnlyOnWeekend: flags.WaybarShortOnlyOnWeekend,
+				JSON:               flags.WaybarJSON,
+				Sparkline:          flags.WaybarSparkline,
+				SparklineWindow:    flags.SparklineWindow,
 			}))
 		}
 
@@ -71,14 +106,36 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
+		if flags.Record != "" {
+			recorder, err := observer.NewRecorder(flags.Record)
+			if err != nil {
+				logrus.WithError(err).Fatal("cannot create recording")
+			}
+			observers = append(observers, recorder)
+		}
+
+		if flags.Store {
+			store, err := observer.NewCandleStore(flags.StoreDir, flags.StoreRetention)
+			if err != nil {
+				logrus.WithError(err).Fatal("cannot open the candle store")
+			}
+			observers = append(observers, store)
+		}
+
 		aggregator.AddObservers(observers...)
 
-		err := aggregator.Register(args...)
+		err = aggregator.Register(args...)
 		if err != nil {
 			logrus.WithError(err).Fatal("register error")
 		}
 
-		aggregator.Start()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = aggregator.Run(ctx)
+		if err != nil {
+			logrus.WithError(err).Fatal("run error")
+		}
 	},
 }
 
@@ -92,12 +149,29 @@ func init() {
 
 	rootCmd.Flags().BoolVar(&flags.Polybar, "polybar", false, "polybar format")
 	rootCmd.Flags().BoolVar(&flags.PolybarShortOnlyOnWeekend, "polybar-weekend-short", false, "short display on weekend")
+	rootCmd.Flags().IntVar(&flags.PolybarSparkline, "polybar-sparkline", 0, "width of the price chart, 0 hides it")
 
 	rootCmd.Flags().BoolVar(&flags.Waybar, "waybar", false, "waybar format")
 	rootCmd.Flags().BoolVar(&flags.WaybarShortOnlyOnWeekend, "waybar-weekend-short", false, "short display on weekend")
+	rootCmd.Flags().BoolVar(&flags.WaybarJSON, "waybar-json", false, "waybar json format with a tooltip, for \"return-type\": \"json\"")
+	rootCmd.Flags().IntVar(&flags.WaybarSparkline, "waybar-sparkline", 0, "width of the price chart, 0 hides it")
+
+	rootCmd.Flags().DurationVar(&flags.SparklineWindow, "sparkline-window", time.Hour, "time covered by the polybar and waybar price charts, at most 24h")
 
 	rootCmd.Flags().BoolVar(&flags.JSON, "json", false, "json format")
 	rootCmd.Flags().BoolVar(&flags.Alert, "alert", false, "enable alert")
+
+	rootCmd.Flags().DurationVar(&flags.StallTimeout, "stall-timeout", 2*time.Minute, "reconnect an exchange when it sends no update for this long while online, 0 disables")
+
+	rootCmd.Flags().StringVar(&flags.Connectivity, "connectivity", "tcp", "internet connectivity check: tcp, http, online (assume online) or exchange (ping the exchange apis)")
+	rootCmd.Flags().StringSliceVar(&flags.ConnectivityTargets, "connectivity-target", nil, "host:port targets of the tcp check or the url of the http check")
+
+	rootCmd.Flags().StringVar(&flags.Record, "record", "", "record market updates to a file")
+	rootCmd.Flags().BoolVar(&flags.Store, "store", false, "store 1m candles of the markets on disk")
+	rootCmd.Flags().StringVar(&flags.StoreDir, "store-dir", observer.DefaultStoreDir(), "directory of the candle store")
+	rootCmd.Flags().DurationVar(&flags.StoreRetention, "store-retention", 30*24*time.Hour, "delete stored candles older than this, 0 keeps them forever")
+	rootCmd.Flags().StringVar(&flags.Replay, "replay", "", "replay a recording with the replay exchange")
+	rootCmd.Flags().Float64Var(&flags.ReplaySpeed, "replay-speed", 1, "replay speed multiplier, 0 replays instantly")
 }
 
 func main() {
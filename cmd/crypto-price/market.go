@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var marketFlags = struct {
+	API string
+}{}
+
+// marketCmd controls the markets of a running crypto-price started with --server
+var marketCmd = &cobra.Command{
+	Use:   "market",
+	Short: "Add or remove markets of a running crypto-price",
+	Long:  `Add or remove markets of a running crypto-price. The running process must be started with --server.`,
+}
+
+var marketListCmd = &cobra.Command{
+	Use:          "list",
+	SilenceUsage: true,
+	Short:        "List the tracked markets",
+	Args:         cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return marketRequest(http.MethodGet, "/api/markets", nil)
+	},
+}
+
+var marketAddCmd = &cobra.Command{
+	Use:          "add {exchange:ticker}...",
+	SilenceUsage: true,
+	Short:        "Start tracking markets",
+	Args:         cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, market := range args {
+			form := url.Values{"market": {market}}
+			err := marketRequest(http.MethodPost, "/api/markets", strings.NewReader(form.Encode()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var marketRemoveCmd = &cobra.Command{
+	Use:          "remove {exchange:ticker}...",
+	SilenceUsage: true,
+	Short:        "Stop tracking markets",
+	Args:         cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, key := range args {
+			err := marketRequest(http.MethodDelete, "/api/markets/"+url.PathEscape(key), nil)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func marketRequest(method, path string, body io.Reader) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(marketFlags.API, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+func init() {
+	marketCmd.PersistentFlags().StringVar(&marketFlags.API, "api", "http://localhost:23232", "api server of the running crypto-price")
+	marketCmd.AddCommand(marketListCmd, marketAddCmd, marketRemoveCmd)
+	rootCmd.AddCommand(marketCmd)
+}
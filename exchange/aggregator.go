@@ -2,8 +2,14 @@ package exchange
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -14,17 +20,94 @@ type Observer interface {
 	Update(info MarketDisplayInfo)
 }
 
+// RemoveObserver is implemented by observers which keep state per market.
+// Remove is called with the market key when a market is removed at runtime.
+type RemoveObserver interface {
+	Remove(key string)
+}
+
+// RawObserver is implemented by observers which need the updates as the exchanges sent them, e.g. a recorder.
+// UpdateRaw is called instead of Update, before the options like ConvertToSatoshi are applied.
+type RawObserver interface {
+	UpdateRaw(info MarketDisplayInfo)
+}
+
+// CandleObserver is implemented by observers which keep the candles the aggregator builds from the updates, e.g. a store.
+// CandleCompleted is called with every completed candle of the DefaultBuilderPeriods, before the update which completed it.
+type CandleObserver interface {
+	CandleCompleted(market Market, candle Candle)
+}
+
+// HistoryObserver is implemented by observers which show the price history of the markets, e.g. in a chart.
+// MarketDisplayInfo.History is only filled in the updates of the observers which want it.
+type HistoryObserver interface {
+	WantsHistory() bool
+}
+
 type Options struct {
 	ConvertToSatoshi bool
+	// StallTimeout forces a reconnect when an exchange sends no update for this long while online. 0 disables the watchdog.
+	StallTimeout time.Duration
+}
+
+// runningExchange is the state of an exchange goroutine
+type runningExchange struct {
+	exchange Exchange           // the connected exchange, nil while waiting to reconnect
+	cancel   context.CancelFunc // cancels the current connection
+	restart  bool               // the connection was cancelled to apply market changes
+	err      error              // reason of a forced reconnect
+	wake     chan struct{}      // interrupts the wait before a reconnect
+}
+
+// registerError is a market which the exchange rejected. Reconnecting does not fix it,
+// the exchange waits for a change of its markets instead.
+type registerError struct {
+	market string
+	err    error
+}
+
+func (e *registerError) Error() string {
+	return fmt.Sprintf("%s: %s", e.market, e.err)
+}
+
+func (e *registerError) Unwrap() error {
+	return e.err
+}
+
+// exchangeUpdate is a market update tagged with the name of the exchange which sent it
+type exchangeUpdate struct {
+	exchange string
+	market   Market
+}
+
+// marketHistory is the recent prices of a market fetched from its exchange
+type marketHistory struct {
+	key    string
+	points []PricePoint
+}
+
+// marketStatus is the last known state of a market
+type marketStatus struct {
+	exchange string // name of the exchange which sends the market
+	info     MarketDisplayInfo
+	history  *priceHistory
 }
 
 type Aggregator struct {
-	exchanges map[string]func() Exchange // exchange name - exchange constructor
-	markets   map[string][]string        // exchange name - markets
-	options   Options
-	update    chan Market
-	cancel    context.CancelFunc
-	observers  []Observer
+	exchanges    map[string]func() Exchange  // exchange name - exchange constructor
+	markets      map[string][]string         // exchange name - markets
+	running      map[string]*runningExchange // exchange name - running exchange
+	removedKeys  map[string]bool             // source keys of the markets removed at runtime
+	ctx          context.Context             // context of the running exchanges, nil before start
+	mu           sync.Mutex                  // guards markets, running, removedKeys and ctx
+	options      Options
+	update       chan exchangeUpdate
+	remove       chan string // source keys of the removed markets
+	connection   chan ConnectionEvent
+	history      chan marketHistory
+	wg           sync.WaitGroup // running exchange and backfill goroutines
+	observers    []Observer
+	connectivity ConnectivityChecker // answers with the last check, see cachedChecker
 }
 
 // NewAggregator creates a new default clients
@@ -32,20 +115,111 @@ func NewAggregator(options Options, observers... Observer) *Aggregator {
 	return &Aggregator{
 		exchanges: map[string]func() Exchange{
 			"binance": NewBinance,
-			"fake":    NewFake,
+			"fake":    newFakeConstructor(),
+			"binance-futures": func() Exchange {
+				return NewBinanceFutures(Endpoints{})
+			},
+			"coinbase": func() Exchange {
+				return NewCoinbase(Endpoints{})
+			},
+			"kraken": func() Exchange {
+				return NewKraken(Endpoints{})
+			},
+			"bybit": func() Exchange {
+				return NewBybit(Endpoints{})
+			},
+			"okx": func() Exchange {
+				return NewOKX(Endpoints{})
+			},
+			"http": func() Exchange {
+				return NewHTTPPoller(configPath("http.json"))
+			},
+			"exec": func() Exchange {
+				return NewExec(configPath("exec.json"))
+			},
 		},
-		markets:  make(map[string][]string),
-		options:  options,
-		update:   make(chan Market, 1),
-		observers: observers,
+		markets:      make(map[string][]string),
+		options:      options,
+		update:       make(chan exchangeUpdate, 1),
+		observers:    observers,
+		running:      make(map[string]*runningExchange),
+		removedKeys:  make(map[string]bool),
+		remove:       make(chan string),
+		connection:   make(chan ConnectionEvent),
+		history:      make(chan marketHistory),
+		connectivity: newCachedChecker(NewTCPChecker()),
 	}
 }
 
+// AddExchange adds or replaces the exchange constructor used for the given exchange name
+func (c *Aggregator) AddExchange(name string, create func() Exchange) {
+	c.exchanges[strings.ToLower(name)] = create
+}
+
+// SetConnectivityChecker replaces the tcp checker used to tell a quiet market from a lost connection
+func (c *Aggregator) SetConnectivityChecker(checker ConnectivityChecker) {
+	c.connectivity = newCachedChecker(checker)
+}
+
+// Ping pings the running exchanges implementing Pinger. It succeeds when any of them answers or none of them can be pinged.
+func (c *Aggregator) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	pingers := make([]Pinger, 0, len(c.running))
+	for _, running := range c.running {
+		if pinger, ok := running.exchange.(Pinger); ok {
+			pingers = append(pingers, pinger)
+		}
+	}
+	c.mu.Unlock()
+
+	var err error
+	for _, pinger := range pingers {
+		err = pinger.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// OrderBook returns the order book depth of a market registered with the depth option.
+// The key format is exchange:base-quote, levels is the number of price levels per side.
+func (c *Aggregator) OrderBook(key string, levels int) (OrderBookDepth, error) {
+	exchangeName, marketName, err := parseFormat(key)
+	if err != nil {
+		return OrderBookDepth{}, err
+	}
+	base, quote, _, err := parseMarket(marketName)
+	if err != nil {
+		return OrderBookDepth{}, err
+	}
+
+	c.mu.Lock()
+	var ex Exchange
+	if running, ok := c.running[exchangeName]; ok {
+		ex = running.exchange
+	}
+	c.mu.Unlock()
+
+	if ex == nil {
+		return OrderBookDepth{}, fmt.Errorf("exchange is not connected")
+	}
+	orderBooker, ok := ex.(OrderBooker)
+	if !ok {
+		return OrderBookDepth{}, fmt.Errorf("exchange does not support order books")
+	}
+	depth, err := orderBooker.OrderBook(base, quote, levels)
+	if err == nil && c.options.ConvertToSatoshi && quote == "btc" {
+		depth = depth.ToSatoshi()
+	}
+	return depth, err
+}
+
 func (c *Aggregator) AddObservers(formatter ...Observer) {
 	c.observers = append(c.observers, formatter...)
 }
 
-// Register adds a new markets. The format is exchange:marketname
+// Register adds a new markets. The format is exchange:marketname or exchange:marketname?key=value
 func (c *Aggregator) Register(format ...string) error {
 	for _, f := range format {
 		err := c.register(f)
@@ -57,115 +231,792 @@ func (c *Aggregator) Register(format ...string) error {
 }
 
 func (c *Aggregator) register(format string) error {
+	exchangeName, marketName, err := parseFormat(format)
+	if err != nil {
+		return err
+	}
+	c.markets[exchangeName] = append(c.markets[exchangeName], marketName)
+
+	return nil
+}
+
+// parseFormat splits the exchange:marketname format
+func parseFormat(format string) (exchangeName string, marketName string, err error) {
 	slice := strings.SplitN(format, ":", 2)
 	if len(slice) != 2 {
-		return fmt.Errorf("invalid format")
+		return "", "", fmt.Errorf("invalid format")
 	}
-	exchangeName := strings.ToLower(slice[0])
-	c.markets[exchangeName] = append(c.markets[exchangeName], slice[1])
+	return strings.ToLower(slice[0]), slice[1], nil
+}
+
+// parseMarket parses a market in base-quote or base-quote?key=value format
+func parseMarket(marketName string) (base string, quote string, options url.Values, err error) {
+	marketName, query, _ := strings.Cut(marketName, "?")
+	marketName = strings.ToLower(marketName)
+
+	pair := strings.Split(marketName, "-")
+	if len(pair) != 2 {
+		return "", "", nil, fmt.Errorf("invalid product format")
+	}
+
+	options, err = url.ParseQuery(query)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid market options: %w", err)
+	}
+	return pair[0], pair[1], options, nil
+}
+
+// normalizePair returns the pair of the updates of a market registered as base-quote.
+// The normalizer is nil for exchanges which send the markets with their registered symbols.
+func normalizePair(normalizer PairNormalizer, base, quote string) (string, string) {
+	if normalizer == nil {
+		return base, quote
+	}
+	return normalizer.NormalizePair(base, quote)
+}
+
+// indexOfMarket returns the index of the base-quote market in the markets of the exchange or -1. Must be called with mu held.
+func (c *Aggregator) indexOfMarket(exchangeName string, normalizer PairNormalizer, base, quote string) int {
+	base, quote = normalizePair(normalizer, base, quote)
+	for i, marketName := range c.markets[exchangeName] {
+		b, q, _, err := parseMarket(marketName)
+		if err != nil {
+			continue
+		}
+		b, q = normalizePair(normalizer, b, q)
+		if b == base && q == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// sourceKey identifies a market by the name of the exchange which sends it and its pair.
+// It differs from the market key when the exchange sends other markets, e.g. replay:btc-usdt replays binance:btc-usdt.
+func sourceKey(exchangeName string, market Market) string {
+	return strings.ToLower(exchangeName + ":" + market.Base + "-" + market.Quote)
+}
 
+// AddMarket adds a market while the aggregator is running. The format is the same as in Register.
+// Exchanges implementing Subscriber subscribe to the market on the live connection, other exchanges are restarted.
+func (c *Aggregator) AddMarket(format string) error {
+	exchangeName, marketName, err := parseFormat(format)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.exchanges[exchangeName]; !ok {
+		return fmt.Errorf("exchange not found")
+	}
+	// a market which cannot be registered would fail every start of the exchange
+	ex := c.exchanges[exchangeName]()
+	err = registerMarket(ex, marketName)
+	if err != nil {
+		return err
+	}
+
+	normalizer, _ := ex.(PairNormalizer)
+	err = c.addMarket(exchangeName, normalizer, marketName)
+	if err != nil {
+		return err
+	}
+	// the history of a market which could not be added is not fetched
+	c.mu.Lock()
+	if c.ctx != nil {
+		c.backfill(c.ctx, ex, exchangeName, marketName)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// addMarket adds a registrable market to the markets of an exchange and subscribes to it or restarts the exchange
+func (c *Aggregator) addMarket(exchangeName string, normalizer PairNormalizer, marketName string) error {
+	base, quote, options, err := parseMarket(marketName)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.indexOfMarket(exchangeName, normalizer, base, quote) != -1 {
+		c.mu.Unlock()
+		return fmt.Errorf("market already registered")
+	}
+	c.markets[exchangeName] = append(c.markets[exchangeName], marketName)
+	normalizedBase, normalizedQuote := normalizePair(normalizer, base, quote)
+	delete(c.removedKeys, sourceKey(exchangeName, Market{Base: normalizedBase, Quote: normalizedQuote}))
+
+	running, ok := c.running[exchangeName]
+	if !ok {
+		if c.ctx != nil {
+			c.runExchange(c.ctx, exchangeName)
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	ex := running.exchange
+	c.mu.Unlock()
+
+	// the next connection picks up the market
+	if ex == nil {
+		c.restartExchange(exchangeName)
+		return nil
+	}
+
+	subscriber, ok := ex.(Subscriber)
+	if !ok || len(options) > 0 {
+		c.restartExchange(exchangeName)
+		return nil
+	}
+
+	err = subscriber.Subscribe(base, quote)
+	if err != nil {
+		c.mu.Lock()
+		if i := c.indexOfMarket(exchangeName, normalizer, base, quote); i != -1 {
+			markets := c.markets[exchangeName]
+			c.markets[exchangeName] = append(markets[:i:i], markets[i+1:]...)
+		}
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RemoveMarket removes a market while the aggregator is running. The key format is exchange:base-quote.
+// Exchanges implementing Subscriber unsubscribe from the market on the live connection, other exchanges are restarted.
+func (c *Aggregator) RemoveMarket(key string) error {
+	exchangeName, marketName, err := parseFormat(key)
+	if err != nil {
+		return err
+	}
+	create, ok := c.exchanges[exchangeName]
+	if !ok {
+		return fmt.Errorf("exchange not found")
+	}
+	base, quote, _, err := parseMarket(marketName)
+	if err != nil {
+		return err
+	}
+	normalizer, _ := create().(PairNormalizer)
+	normalizedBase, normalizedQuote := normalizePair(normalizer, base, quote)
+	// the updates of the market may have another key, e.g. replay:btc-usdt sends binance:btc-usdt
+	key = sourceKey(exchangeName, Market{Base: normalizedBase, Quote: normalizedQuote})
+
+	c.mu.Lock()
+	i := c.indexOfMarket(exchangeName, normalizer, base, quote)
+	if i == -1 {
+		c.mu.Unlock()
+		return fmt.Errorf("market not found")
+	}
+	markets := c.markets[exchangeName]
+	c.markets[exchangeName] = append(markets[:i:i], markets[i+1:]...)
+	c.removedKeys[key] = true
+	remaining := len(c.markets[exchangeName])
+	ctx := c.ctx
+	var ex Exchange
+	if running, ok := c.running[exchangeName]; ok {
+		ex = running.exchange
+	}
+	c.mu.Unlock()
+
+	subscriber, ok := ex.(Subscriber)
+	if remaining > 0 && ok {
+		err = subscriber.Unsubscribe(base, quote)
+		if err != nil {
+			logrus.WithError(err).WithField("market", key).Warn("cannot unsubscribe, restarting exchange")
+			c.restartExchange(exchangeName)
+		}
+	} else {
+		// an exchange without markets stops after the restart
+		c.restartExchange(exchangeName)
+	}
+
+	if ctx != nil {
+		select {
+		case c.remove <- key:
+		case <-ctx.Done():
+		}
+	}
 	return nil
 }
 
+// restartExchange cancels the current connection of an exchange and reconnects without waiting
+func (c *Aggregator) restartExchange(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	running, ok := c.running[name]
+	if !ok {
+		return
+	}
+	if running.cancel != nil {
+		running.restart = true
+		running.cancel()
+		return
+	}
+	// a waiting exchange starts with the new markets right away
+	select {
+	case running.wake <- struct{}{}:
+	default:
+	}
+}
+
 func (c *Aggregator) applyOptions(info *MarketDisplayInfo) {
 	if c.options.ConvertToSatoshi && strings.EqualFold(info.Market.Quote, "btc") {
 		info.Market.Candle = info.Market.Candle.ToSatoshi()
+		// the timeframes are shared with the stored status
+		info.Market.Timeframes = append([]Timeframe(nil), info.Market.Timeframes...)
+		for i := range info.Market.Timeframes {
+			info.Market.Timeframes[i].Candle = info.Market.Timeframes[i].Candle.ToSatoshi()
+		}
+		info.Market.Book.Bid *= 100_000_000
+		info.Market.Book.Ask *= 100_000_000
+		for i := range info.Candles {
+			info.Candles[i] = info.Candles[i].ToSatoshi()
+		}
+		for i := range info.History {
+			info.History[i].Price *= 100_000_000
+		}
 	}
 }
 
-func (c *Aggregator) notifyObservers(info MarketDisplayInfo) {
+func (c *Aggregator) notifyObservers(status *marketStatus) {
+	info := status.info
+	// the candles are shared with the stored status
+	info.Candles = append([]Candle(nil), info.Candles...)
 	c.applyOptions(&info)
+	// the history is copied only for the observers showing it
+	var withHistory *MarketDisplayInfo
 	for _, observer := range c.observers {
+		if rawObserver, ok := observer.(RawObserver); ok {
+			rawObserver.UpdateRaw(status.info)
+			continue
+		}
+		if historyObserver, ok := observer.(HistoryObserver); ok && historyObserver.WantsHistory() && status.history != nil {
+			if withHistory == nil {
+				withHistory = &MarketDisplayInfo{}
+				*withHistory = status.info
+				withHistory.Candles = append([]Candle(nil), status.info.Candles...)
+				withHistory.History = status.history.list()
+				c.applyOptions(withHistory)
+			}
+			observer.Update(*withHistory)
+			continue
+		}
 		observer.Update(info)
 	}
 }
 
+// notifyCandles notifies the observers implementing CandleObserver about the completed candles of a market
+func (c *Aggregator) notifyCandles(market Market, completed []Candle) {
+	convert := c.options.ConvertToSatoshi && strings.EqualFold(market.Quote, "btc")
+	for _, candle := range completed {
+		if convert {
+			candle = candle.ToSatoshi()
+		}
+		for _, observer := range c.observers {
+			if candleObserver, ok := observer.(CandleObserver); ok {
+				candleObserver.CandleCompleted(market, candle)
+			}
+		}
+	}
+}
+
+// registerMarket registers a market in base-quote or base-quote?key=value format.
+// The book and depth options are handled here, they enable the book ticker of exchanges implementing BookTickerer
+// and the order book of exchanges implementing OrderBooker.
+func registerMarket(ex Exchange, marketName string) error {
+	base, quote, options, err := parseMarket(marketName)
+	if err != nil {
+		return err
+	}
+
+	book, err := popBoolOption(options, "book")
+	if err != nil {
+		return err
+	}
+	depth, err := popBoolOption(options, "depth")
+	if err != nil {
+		return err
+	}
+
+	if len(options) == 0 {
+		err = ex.Register(base, quote)
+	} else if optionsExchange, ok := ex.(OptionsRegisterer); ok {
+		err = optionsExchange.RegisterWithOptions(base, quote, options)
+	} else {
+		return fmt.Errorf("exchange does not support market options")
+	}
+	if err != nil {
+		return err
+	}
+
+	if book {
+		bookTickerer, ok := ex.(BookTickerer)
+		if !ok {
+			return fmt.Errorf("exchange does not support the book ticker")
+		}
+		err = bookTickerer.EnableBookTicker(base, quote)
+		if err != nil {
+			return err
+		}
+	}
+	if depth {
+		orderBooker, ok := ex.(OrderBooker)
+		if !ok {
+			return fmt.Errorf("exchange does not support order books")
+		}
+		return orderBooker.EnableOrderBook(base, quote)
+	}
+	return nil
+}
+
+// popBoolOption parses and removes a boolean market option, false when it is not set
+func popBoolOption(options url.Values, name string) (bool, error) {
+	v := options.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	options.Del(name)
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s option: %w", name, err)
+	}
+	return enabled, nil
+}
+
 func (c *Aggregator) startExchange(ctx context.Context, name string) error {
 	createExchange, ok := c.exchanges[name]
 	if !ok {
 		return fmt.Errorf("exchange not found")
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	ex := createExchange()
+	c.mu.Lock()
 	for _, marketName := range c.markets[name] {
-		marketName = strings.ToLower(marketName)
+		err := registerMarket(ex, marketName)
+		if err != nil {
+			c.mu.Unlock()
+			return &registerError{market: marketName, err: err}
+		}
+	}
+	running := c.running[name]
+	running.exchange = ex
+	running.cancel = cancel
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		running.exchange = nil
+		running.cancel = nil
+		c.mu.Unlock()
+	}()
+
+	update := make(chan Market)
+	done := make(chan struct{})
+	defer close(done)
+	go c.forward(name, update, done)
+
+	return ex.Start(ctx, update)
+}
 
-		pair := strings.Split(marketName, "-")
-		if len(pair) != 2 {
-			return fmt.Errorf("invalid product format")
+// forward tags the updates of an exchange with its name until done is closed.
+// The exchanges send their updates with send, which gives up once the context of Start is canceled after it returned.
+func (c *Aggregator) forward(name string, update <-chan Market, done <-chan struct{}) {
+	for {
+		select {
+		case market := <-update:
+			select {
+			case c.update <- exchangeUpdate{exchange: name, market: market}:
+			case <-done:
+				return
+			}
+		case <-done:
+			return
 		}
+	}
+}
 
-		err := ex.Register(pair[0], pair[1])
-		if err != nil {
-			return err
+// emit sends a connection event to the aggregator loop
+func (c *Aggregator) emit(ctx context.Context, event ConnectionEvent) {
+	event.Time = time.Now()
+	select {
+	case c.connection <- event:
+	case <-ctx.Done():
+	}
+}
+
+// connectionChanged stores the connection state of an exchange and notifies the observers about it and about the markets of the exchange
+func (c *Aggregator) connectionChanged(connections map[string]ConnectionEvent, statuses map[string]*marketStatus, event ConnectionEvent) {
+	connections[event.Exchange] = event
+	for _, observer := range c.observers {
+		if connectionObserver, ok := observer.(ConnectionObserver); ok {
+			connectionObserver.ConnectionChanged(event)
 		}
 	}
+	for _, key := range sortedKeys(statuses) {
+		status := statuses[key]
+		if status.exchange == event.Exchange {
+			status.info.Connection = event
+			c.notifyObservers(status)
+		}
+	}
+}
 
-	return ex.Start(ctx, c.update)
+// heartbeat re-notifies the observers about every market.
+// The connection of a market is confirmed when its exchange is connected and it has sent data recently or the internet is reachable.
+func (c *Aggregator) heartbeat(statuses map[string]*marketStatus) {
+	checked, online := false, false
+	for _, key := range sortedKeys(statuses) {
+		status := statuses[key]
+		if status.info.Connection.State == Connected {
+			// we don't have to check network connection if we have recently received any data
+			if time.Since(status.info.Market.LastUpdate) <= time.Second*7 {
+				status.info.LastConfirmedConnectionTime = time.Now()
+			} else {
+				if !checked {
+					online = c.connectivity.Online()
+					checked = true
+				}
+				if online {
+					status.info.LastConfirmedConnectionTime = time.Now()
+				}
+			}
+		}
+		c.notifyObservers(status)
+	}
 }
 
-func (c *Aggregator) startAllExchange() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	c.cancel = cancel
+// reconnectAll reconnects every exchange immediately, the waiting ones too
+func (c *Aggregator) reconnectAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, running := range c.running {
+		if running.cancel != nil {
+			running.restart = true
+			running.cancel()
+			continue
+		}
+		select {
+		case running.wake <- struct{}{}:
+		default:
+		}
+	}
+}
 
-	for name := range c.markets {
-		go func(name string) {
-			bf := backoff.NewExponentialBackOff()
-			for {
-				err := c.startExchange(ctx, name)
-				if err != nil {
-					logrus.WithError(err).WithField("name", name).Error("exchange stoped")
+// watchdog forces a reconnect of the exchanges which have not sent any update within the stall timeout while online
+func (c *Aggregator) watchdog(connections map[string]ConnectionEvent, lastUpdates map[string]time.Time) {
+	if c.options.StallTimeout <= 0 {
+		return
+	}
+
+	checked, online := false, false
+	for name, event := range connections {
+		if event.State != Connecting && event.State != Connected {
+			continue
+		}
+		last := event.Time
+		if lastUpdates[name].After(last) {
+			last = lastUpdates[name]
+		}
+
+		c.mu.Lock()
+		running, ok := c.running[name]
+		if !ok || running.exchange == nil || running.cancel == nil {
+			c.mu.Unlock()
+			continue
+		}
+		timeout := c.options.StallTimeout
+		if stallTimeouter, ok := running.exchange.(StallTimeouter); ok {
+			exchangeTimeout := stallTimeouter.StallTimeout()
+			if exchangeTimeout == 0 {
+				c.mu.Unlock()
+				continue
+			}
+			timeout = max(timeout, exchangeTimeout)
+		}
+		c.mu.Unlock()
+
+		silence := time.Since(last)
+		if silence < timeout {
+			continue
+		}
+		// without internet a reconnect would not help
+		if !checked {
+			online = c.connectivity.Online()
+			checked = true
+		}
+		if !online {
+			continue
+		}
+
+		logrus.WithField("name", name).WithField("silence", silence).Warn("exchange stalled, reconnecting")
+		c.mu.Lock()
+		if running, ok := c.running[name]; ok && running.cancel != nil {
+			running.err = fmt.Errorf("stalled: no update for %s", silence.Round(time.Second))
+			running.cancel()
+		}
+		c.mu.Unlock()
+	}
+}
+
+func sortedKeys(statuses map[string]*marketStatus) []string {
+	keys := make([]string, 0, len(statuses))
+	for key := range statuses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runExchange starts an exchange and keeps it running until it has markets. Must be called with mu held.
+func (c *Aggregator) runExchange(ctx context.Context, name string) {
+	c.running[name] = &runningExchange{wake: make(chan struct{}, 1)}
+	c.wg.Add(1)
+
+	go func() {
+		defer c.wg.Done()
+		bf := backoff.NewExponentialBackOff()
+		for {
+			c.mu.Lock()
+			stopped := len(c.markets[name]) == 0 || ctx.Err() != nil
+			if stopped {
+				delete(c.running, name)
+			}
+			c.mu.Unlock()
+			if stopped {
+				logrus.WithField("name", name).Info("exchange stopped")
+				return
+			}
+
+			c.emit(ctx, ConnectionEvent{Exchange: name, State: Connecting})
+			err := c.startExchange(ctx, name)
+
+			c.mu.Lock()
+			running := c.running[name]
+			restart := running.restart
+			running.restart = false
+			if running.err != nil {
+				err = running.err
+				running.err = nil
+			}
+			c.mu.Unlock()
+			if restart || ctx.Err() != nil {
+				if restart {
+					logrus.WithField("name", name).Info("restart exchange")
 				}
-				if bf.GetElapsedTime() >= time.Minute {
-					bf.Reset()
+				continue
+			}
+
+			var rejected *registerError
+			if errors.As(err, &rejected) {
+				logrus.WithError(err).WithField("name", name).Error("exchange failed, waiting for a change of its markets")
+				c.emit(ctx, ConnectionEvent{Exchange: name, State: Failed, Err: err})
+				select {
+				case <-ctx.Done():
+				case <-running.wake:
 				}
-				wait := bf.NextBackOff()
-				logrus.WithField("duration", wait).Info("wait to restart")
-				time.Sleep(wait)
+				continue
+			}
+
+			if err != nil {
+				logrus.WithError(err).WithField("name", name).Warn("exchange stopped")
+			}
+			if bf.GetElapsedTime() >= time.Minute {
+				bf.Reset()
 			}
-		}(name)
+			wait := bf.NextBackOff()
+			logrus.WithField("duration", wait).Info("wait to restart")
+			c.emit(ctx, ConnectionEvent{Exchange: name, State: Reconnecting, Delay: wait, Err: err})
+			select {
+			case <-ctx.Done():
+			case <-running.wake:
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// backfill fetches the recent prices of a market in the background when its exchange implements HistoryProvider.
+// Must be called with mu held.
+func (c *Aggregator) backfill(ctx context.Context, ex Exchange, exchangeName, marketName string) {
+	provider, ok := ex.(HistoryProvider)
+	if !ok {
+		return
+	}
+	base, quote, _, err := parseMarket(marketName)
+	if err != nil {
+		return
+	}
+	key := exchangeName + ":" + base + "-" + quote
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		points, err := provider.History(ctx, base, quote, time.Now().Add(-historySize*historyInterval))
+		if err != nil {
+			logrus.WithError(err).WithField("market", key).Warn("cannot backfill the price history")
+			return
+		}
+		select {
+		case c.history <- marketHistory{key: key, points: points}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// Run starts the exchanges and notifies the observers until ctx is done.
+// Before returning every exchange is stopped and the observers implementing io.Closer are closed.
+func (c *Aggregator) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	for name := range c.markets {
+		if _, ok := c.exchanges[name]; !ok {
+			c.mu.Unlock()
+			return fmt.Errorf("exchange not found: %s", name)
+		}
+	}
+	c.ctx = ctx
+	for name, markets := range c.markets {
+		c.runExchange(ctx, name)
+		// the history providers fetch any pair, one instance serves every market
+		ex := c.exchanges[name]()
+		for _, marketName := range markets {
+			c.backfill(ctx, ex, name, marketName)
+		}
 	}
+	c.mu.Unlock()
+
+	defer c.shutdown(cancel)
 
 	ticker := time.NewTicker(time.Second * 4)
-	var info MarketDisplayInfo
+	defer ticker.Stop()
+	statuses := make(map[string]*marketStatus)      // market key - status
+	connections := make(map[string]ConnectionEvent) // exchange name - last connection event
+	lastUpdates := make(map[string]time.Time)       // exchange name - time of the last update
+	histories := make(map[string]*priceHistory)     // market key - close prices
+	builders := make(map[string]*CandleBuilder)     // market key - candles of the DefaultBuilderPeriods
+	suspend := newSuspendDetector(time.Second * 10)
 	for {
 		select {
+		case <-ctx.Done():
+			return nil
 		case <-ticker.C:
-			// we didn't have any market update yet.
-			if info.Market.Base == "" {
+			// the connections and the candles are stale after a resume
+			if suspended, ok := suspend.check(time.Now()); ok {
+				logrus.WithField("suspended", suspended).Info("resumed from suspend, reconnecting exchanges")
+				c.reconnectAll()
+			}
+			c.heartbeat(statuses)
+			c.watchdog(connections, lastUpdates)
+		case event := <-c.connection:
+			c.connectionChanged(connections, statuses, event)
+		case backfilled := <-c.history:
+			c.mu.Lock()
+			removed := c.removedKeys[backfilled.key]
+			c.mu.Unlock()
+			if removed {
 				continue
 			}
-			// we don't have to check network connection if we have recently received any data
-			if time.Since(info.Market.LastUpdate) <= time.Second*7 {
-				info.LastConfirmedConnectionTime = time.Now()
-			} else if HasInternetConnection() {
-				info.LastConfirmedConnectionTime = time.Now()
+			history, ok := histories[backfilled.key]
+			if !ok {
+				history = newPriceHistory(historySize, historyInterval)
+				histories[backfilled.key] = history
+			}
+			history.prefill(backfilled.points)
+			if status, ok := statuses[backfilled.key]; ok {
+				c.notifyObservers(status)
 			}
-			c.notifyObservers(info)
-		case data, ok := <-c.update:
+		case source := <-c.remove:
+			delete(histories, source)
+			for _, key := range sortedKeys(statuses) {
+				if sourceKey(statuses[key].exchange, statuses[key].info.Market) != source {
+					continue
+				}
+				delete(statuses, key)
+				delete(histories, key)
+				delete(builders, key)
+				for _, observer := range c.observers {
+					if remover, ok := observer.(RemoveObserver); ok {
+						remover.Remove(key)
+					}
+				}
+			}
+		case data := <-c.update:
+			lastUpdates[data.exchange] = time.Now()
+			// drop the updates sent before the market was removed
+			key := data.market.Key()
+			c.mu.Lock()
+			removed := c.removedKeys[sourceKey(data.exchange, data.market)]
+			c.mu.Unlock()
+			if removed {
+				continue
+			}
+			history, ok := histories[key]
+			if !ok {
+				history = newPriceHistory(historySize, historyInterval)
+				histories[key] = history
+			}
+			history.add(time.Now(), data.market.Candle.Close)
+			builder, ok := builders[key]
 			if !ok {
-				logrus.Info("update channel closed")
-				break
+				builder = NewCandleBuilder()
+				builders[key] = builder
+			}
+			completed := builder.Update(data.market.LastUpdate, data.market.Candle.Close)
+			// the refetched candles and the tickers without volume add nothing
+			builder.AddVolume(data.market.tradedVolume, data.market.tradedQuoteVolume)
+			c.notifyCandles(data.market, completed)
+			status := &marketStatus{
+				exchange: data.exchange,
+				info: MarketDisplayInfo{
+					Market:                      data.market,
+					LastConfirmedConnectionTime: time.Now(),
+					Connection:                  connections[data.exchange],
+					Candles:                     builder.Candles(),
+				},
+				history: history,
 			}
-			info.Market = data
-			info.LastConfirmedConnectionTime = time.Now()
-			c.notifyObservers(info)
+			statuses[key] = status
+			// the first data after a start confirms the connection
+			if status.info.Connection.State != Connected {
+				c.connectionChanged(connections, statuses, ConnectionEvent{Exchange: data.exchange, State: Connected, Time: time.Now()})
+				continue
+			}
+			c.notifyObservers(status)
 		}
 	}
 }
 
-func (c *Aggregator) Start() {
-	for {
-		err := c.startAllExchange()
-		defer c.cancel()
-		if err != nil {
-			logrus.WithError(err).Error("exchanges stoped")
+// shutdown stops the exchanges and closes the observers
+func (c *Aggregator) shutdown(cancel context.CancelFunc) {
+	c.mu.Lock()
+	c.ctx = nil
+	c.mu.Unlock()
+	cancel()
+
+	// drain the updates, so the exchanges are not blocked while they are stopping
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	for stopped := false; !stopped; {
+		select {
+		case <-c.update:
+		case <-done:
+			stopped = true
 		}
 	}
-}
 
-func (c *Aggregator) Close() error {
-	c.cancel()
-	return nil
+	for _, observer := range c.observers {
+		if closer, ok := observer.(io.Closer); ok {
+			err := closer.Close()
+			if err != nil {
+				logrus.WithError(err).Error("cannot close observer")
+			}
+		}
+	}
 }
@@ -3,99 +3,504 @@ package exchange
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	binance_connector "github.com/binance/binance-connector-go"
 	"github.com/sirupsen/logrus"
 )
 
+// bookTickerInterval is the shortest time between two updates sent for book ticker changes
+const bookTickerInterval = time.Second
+
 type binance struct {
-	markets []*Market
+	mu            sync.Mutex // guards the markets between the streams, the refresh and the subscriptions
+	markets       []*Market
+	books         map[string]bool                 // symbols streaming the book ticker
+	depths        map[string]*binanceOrderBook    // symbol - maintained order book
+	live          *binanceLive                    // nil while the exchange is not started
+	subscriptions map[string]*binanceSubscription // symbol - stream of a market subscribed while running
+}
+
+// binanceLive is the state of the started exchange which the subscriptions share
+type binanceLive struct {
+	ctx        context.Context
+	stream     *binance_connector.WebsocketStreamClient
+	update     chan<- Market
+	errHandler func(err error)
 }
 
-func (b binance) getChartTicker(market *Market) string {
+// binanceSubscription is the kline stream of a market subscribed while the exchange is running.
+// The combined stream of the registered markets cannot be changed on the live connection.
+type binanceSubscription struct {
+	cancel context.CancelFunc // stops the refresh of the market
+	doneC  chan struct{}
+	stopC  chan struct{}
+}
+
+func (b *binance) getChartTicker(market *Market) string {
 	return strings.ToUpper(market.Base + market.Quote)
 }
 
-func (b binance) initMarket(market *Market) error {
+// list returns the current markets
+func (b *binance) list() []*Market {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Market(nil), b.markets...)
+}
+
+// fetchCandle returns the candle of the reference period, the rolling 24h candle comes from the 24hr ticker
+func (b *binance) fetchCandle(ctx context.Context, market *Market, period Period) (Candle, error) {
 	client := binance_connector.NewClient("", "")
-	kline := client.NewKlinesService()
-	kline = kline.Symbol(b.getChartTicker(market)).Interval("1d").Limit(1)
-	result, err := kline.Do(context.Background())
+	symbol := b.getChartTicker(market)
+
+	if period.Rolling() {
+		tickers, err := client.NewTicker24hrService().Symbol(symbol).Do(ctx)
+		if err != nil {
+			return Candle{}, err
+		}
+		if len(tickers) == 0 {
+			return Candle{}, fmt.Errorf("no 24hr ticker for %s", symbol)
+		}
+		t := tickers[0]
+		candle, err := parseCandle(time.UnixMilli(int64(t.OpenTime)), t.OpenPrice, t.HighPrice, t.LowPrice, t.LastPrice)
+		if err != nil {
+			return Candle{}, err
+		}
+		candle.Period = period
+		return candle, parseVolume(&candle, t.Volume, t.QuoteVolume)
+	}
+
+	return periodCandle(period, time.Now(), b.klines(ctx, market))
+}
+
+// klines returns a function fetching the klines of the market from start, oldest first
+func (b *binance) klines(ctx context.Context, market *Market) func(interval string, start time.Time) ([]Candle, error) {
+	client := binance_connector.NewClient("", "")
+	symbol := b.getChartTicker(market)
+
+	return func(interval string, start time.Time) ([]Candle, error) {
+		result, err := client.NewKlinesService().Symbol(symbol).Interval(interval).StartTime(uint64(start.UnixMilli())).Limit(1000).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		klines := make([]Candle, 0, len(result))
+		for _, k := range result {
+			kline, err := parseCandle(time.UnixMilli(int64(k.OpenTime)), k.Open, k.High, k.Low, k.Close)
+			if err != nil {
+				return nil, err
+			}
+			err = parseVolume(&kline, k.Volume, k.QuoteAssetVolume)
+			if err != nil {
+				return nil, err
+			}
+			klines = append(klines, kline)
+		}
+		return klines, nil
+	}
+}
+
+func (b *binance) initMarket(ctx context.Context, market *Market) error {
+	b.mu.Lock()
+	period := market.Candle.Period
+	names := market.timeframeNames()
+	b.mu.Unlock()
+
+	candle, err := b.fetchCandle(ctx, market, period)
 	if err != nil {
 		return err
 	}
-	market.Candle.High, _ = strconv.ParseFloat(result[0].High, 64)
-	market.Candle.Open, _ = strconv.ParseFloat(result[0].Open, 64)
-	market.Candle.Close, _ = strconv.ParseFloat(result[0].Close, 64)
-	market.Candle.Low, _ = strconv.ParseFloat(result[0].Low, 64)
+	// the timeframes are extras, the market is tracked without them
+	timeframes, err := fetchTimeframes(names, time.Now(), b.klines(ctx, market))
+	if err != nil {
+		logrus.WithError(err).WithField("market", market.Key()).Warn("cannot fetch timeframes")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		market.Timeframes = timeframes
+	}
 	market.LastUpdate = time.Now()
+	// the stream may have started a newer candle since the request
+	if candle.Start.Before(market.Candle.Start) {
+		return nil
+	}
+	market.Candle = candle
+	market.streamed = Candle{}
 	return nil
 }
 
 func (b *binance) Register(base string, quote string) error {
-	b.markets = append(b.markets, newMarket("binance", base, quote))
+	return b.RegisterWithOptions(base, quote, nil)
+}
+
+// RegisterWithOptions accepts the period (24h, 1h, 4h, day, week, month), tz (e.g. Europe/Berlin)
+// and timeframes (e.g. 1h,24h,7d,30d) options
+func (b *binance) RegisterWithOptions(base string, quote string, options url.Values) error {
+	period, err := ParsePeriod(options)
+	if err != nil {
+		return fmt.Errorf("binance: %w", err)
+	}
+	names, err := ParseTimeframes(options)
+	if err != nil {
+		return fmt.Errorf("binance: %w", err)
+	}
+	market := newMarket("binance", base, quote)
+	market.Candle.Period = period
+	for _, name := range names {
+		market.Timeframes = append(market.Timeframes, Timeframe{Name: name})
+	}
+	b.markets = append(b.markets, market)
 	return nil
 }
 
-func (b *binance) Start(ctx context.Context, update chan<- Market) error {
+// registeredSymbol returns the symbol of a registered market
+func (b *binance) registeredSymbol(base string, quote string) (string, error) {
 	for _, market := range b.markets {
-		err := b.initMarket(market)
-		if err != nil {
-			return err
+		if market.Base == base && market.Quote == quote {
+			return b.getChartTicker(market), nil
 		}
-		update <- *market
-		runEvery(context.Background(), time.Hour, func() {
-			time.Sleep(time.Second * 10)
-			b.initMarket(market)
-		})
 	}
+	return "", fmt.Errorf("binance: market %s-%s is not registered", base, quote)
+}
 
-	stream := binance_connector.NewWebsocketStreamClient(true)
-	symbolIntervalPair := make(map[string]string)
-	for _, market := range b.markets {
-		symbolIntervalPair[b.getChartTicker(market)] = "5m"
+// EnableBookTicker streams the best bid and ask of a registered market
+func (b *binance) EnableBookTicker(base string, quote string) error {
+	symbol, err := b.registeredSymbol(base, quote)
+	if err != nil {
+		return err
+	}
+	if b.books == nil {
+		b.books = make(map[string]bool)
 	}
+	b.books[symbol] = true
+	return nil
+}
 
-	handler := func(event *binance_connector.WsKlineEvent) {
-		for _, market := range b.markets {
-			if strings.EqualFold(b.getChartTicker(market), event.Symbol) {
-				price, err := strconv.ParseFloat(event.Kline.Close, 64)
-				if err != nil {
-					logrus.WithError(err).WithField("market", event.Symbol).Error("cannot parse price")
-					continue
-				}
-				market.Candle.Update(price)
-				market.LastUpdate = time.Now()
-				update <- *market
-			}
+// EnableOrderBook maintains the order book of a registered market from the diff depth stream
+func (b *binance) EnableOrderBook(base string, quote string) error {
+	symbol, err := b.registeredSymbol(base, quote)
+	if err != nil {
+		return err
+	}
+	if b.depths == nil {
+		b.depths = make(map[string]*binanceOrderBook)
+	}
+	b.depths[symbol] = newBinanceOrderBook(symbol)
+	return nil
+}
+
+// OrderBook returns the best levels and the cumulative depth of a market with an enabled order book
+func (b *binance) OrderBook(base string, quote string, levels int) (OrderBookDepth, error) {
+	book, ok := b.depths[strings.ToUpper(base+quote)]
+	if !ok {
+		return OrderBookDepth{}, fmt.Errorf("binance: order book of %s-%s is not enabled", base, quote)
+	}
+	return book.depth(levels)
+}
+
+// History returns the close prices of the 1m klines since from
+func (b *binance) History(ctx context.Context, base string, quote string, from time.Time) ([]PricePoint, error) {
+	return fetchHistory(from, b.klines(ctx, newMarket("binance", base, quote)))
+}
+
+// Subscribe streams a new market on its own connection while the exchange is running
+func (b *binance) Subscribe(base string, quote string) error {
+	b.mu.Lock()
+	live := b.live
+	b.mu.Unlock()
+	if live == nil {
+		return fmt.Errorf("binance: not connected")
+	}
+
+	market := newMarket("binance", base, quote)
+	market.Candle.Period = UTCDay
+	err := b.initMarket(live.ctx, market)
+	if err != nil {
+		return err
+	}
+	symbol := b.getChartTicker(market)
+
+	ctx, cancel := context.WithCancel(live.ctx)
+	doneC, stopC, err := live.stream.WsCombinedKlineServe(map[string]string{symbol: "5m"}, b.klineHandler(ctx, live.update), live.errHandler)
+	if err != nil {
+		cancel()
+		return err
+	}
+	go func() {
+		select {
+		case <-doneC:
+			live.errHandler(fmt.Errorf("binance: stream of %s stopped", symbol))
+		case <-ctx.Done():
+		}
+	}()
+
+	b.mu.Lock()
+	b.markets = append(b.markets, market)
+	if b.subscriptions == nil {
+		b.subscriptions = make(map[string]*binanceSubscription)
+	}
+	b.subscriptions[symbol] = &binanceSubscription{cancel: cancel, doneC: doneC, stopC: stopC}
+	m := market.Snapshot()
+	b.mu.Unlock()
+
+	b.refresh(ctx, market)
+	send(ctx, live.update, m)
+	return nil
+}
+
+// Unsubscribe stops the updates of a market. The stream of a subscribed market is closed,
+// a registered market stays on the combined stream until the next reconnect and its events are dropped.
+func (b *binance) Unsubscribe(base string, quote string) error {
+	b.mu.Lock()
+	var subscription *binanceSubscription
+	found := false
+	for i, market := range b.markets {
+		if market.Base == base && market.Quote == quote {
+			// copy, so the lists returned earlier are not modified
+			b.markets = append(b.markets[:i:i], b.markets[i+1:]...)
+			symbol := b.getChartTicker(market)
+			subscription = b.subscriptions[symbol]
+			delete(b.subscriptions, symbol)
+			found = true
+			break
 		}
 	}
+	b.mu.Unlock()
 
-	errC := make(chan error)
+	if !found {
+		return fmt.Errorf("market %s-%s not found", base, quote)
+	}
+	if subscription != nil {
+		subscription.cancel()
+		stopStream(subscription.doneC, subscription.stopC)
+	}
+	return nil
+}
+
+// registered reports whether the market is still in the market list
+func (b *binance) registered(market *Market) bool {
+	for _, m := range b.list() {
+		if m == market {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh refetches the candle of a market until ctx is done or the market is unsubscribed.
+// The rolling windows move, the refresh drops the old highs and lows.
+func (b *binance) refresh(ctx context.Context, market *Market) {
+	b.mu.Lock()
+	every := time.Hour
+	if market.Candle.Period.Rolling() || len(market.Timeframes) > 0 {
+		every = time.Minute * 5
+	}
+	b.mu.Unlock()
+
+	runEvery(ctx, every, func() {
+		if !sleep(ctx, time.Second*10) || !b.registered(market) {
+			return
+		}
+		b.initMarket(ctx, market)
+	})
+}
+
+// Ping checks that the rest api is reachable
+func (b *binance) Ping(ctx context.Context) error {
+	return binance_connector.NewClient("", "").NewPingService().Do(ctx)
+}
+
+func (b *binance) Start(ctx context.Context, update chan<- Market) error {
+	errC := make(chan error, 1)
 	errHandler := func(err error) {
-		errC <- err
+		select {
+		case errC <- err:
+		default:
+		}
+	}
+
+	// the markets subscribed from now on have their own streams
+	stream := binance_connector.NewWebsocketStreamClient(true)
+	markets := b.list()
+	b.mu.Lock()
+	b.live = &binanceLive{ctx: ctx, stream: stream, update: update, errHandler: errHandler}
+	b.mu.Unlock()
+	defer b.stopSubscriptions()
+
+	for _, market := range markets {
+		err := b.initMarket(ctx, market)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		m := market.Snapshot()
+		b.mu.Unlock()
+		if !send(ctx, update, m) {
+			return ctx.Err()
+		}
+		b.refresh(ctx, market)
+	}
+
+	symbolIntervalPair := make(map[string]string)
+	for _, market := range markets {
+		symbolIntervalPair[b.getChartTicker(market)] = "5m"
 	}
 
-	doneC, stopC, err := stream.WsCombinedKlineServe(symbolIntervalPair, handler, errHandler)
+	doneC, stopC, err := stream.WsCombinedKlineServe(symbolIntervalPair, b.klineHandler(ctx, update), errHandler)
 	if err != nil {
 		return err
 	}
+	defer stopStream(doneC, stopC)
+
+	// the book ticker has its own stream, nil channels block when no market streams it
+	var bookDoneC chan struct{}
+	if len(b.books) > 0 {
+		symbols := make([]string, 0, len(b.books))
+		for symbol := range b.books {
+			symbols = append(symbols, symbol)
+		}
+		var bookStopC chan struct{}
+		bookDoneC, bookStopC, err = stream.WsCombinedBookTickerServe(symbols, b.bookTickerHandler(ctx, update), errHandler)
+		if err != nil {
+			return err
+		}
+		defer stopStream(bookDoneC, bookStopC)
+	}
+
+	// the diff depth stream must be buffering before the order books fetch their snapshots
+	var depthDoneC chan struct{}
+	if len(b.depths) > 0 {
+		symbols := make([]string, 0, len(b.depths))
+		for symbol := range b.depths {
+			symbols = append(symbols, symbol)
+		}
+		depthHandler := func(event *binance_connector.WsDepthEvent) {
+			if book, ok := b.depths[strings.ToUpper(event.Symbol)]; ok {
+				book.push(event)
+			}
+		}
+		var depthStopC chan struct{}
+		depthDoneC, depthStopC, err = stream.WsCombinedDepthServe100Ms(symbols, depthHandler, errHandler)
+		if err != nil {
+			return err
+		}
+		defer stopStream(depthDoneC, depthStopC)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for _, book := range b.depths {
+			go book.run(ctx)
+		}
+	}
 
 	select {
 	case <-ctx.Done():
-		stopC <- struct{}{}
 		return ctx.Err()
 	case <-doneC:
 		return fmt.Errorf("exchange stopped")
+	case <-bookDoneC:
+		return fmt.Errorf("book ticker stopped")
+	case <-depthDoneC:
+		return fmt.Errorf("depth stream stopped")
 	case err := <-errC:
 		return err
 	}
 }
 
-func NewBinance() Exchange {
-	return &binance{
+// stopSubscriptions closes the streams of the subscribed markets when the exchange stops
+func (b *binance) stopSubscriptions() {
+	b.mu.Lock()
+	subscriptions := b.subscriptions
+	b.subscriptions = nil
+	b.live = nil
+	b.mu.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.cancel()
+		stopStream(subscription.doneC, subscription.stopC)
+	}
+}
+
+// klineHandler merges the 5m klines into the candles of the markets
+func (b *binance) klineHandler(ctx context.Context, update chan<- Market) func(event *binance_connector.WsKlineEvent) {
+	return func(event *binance_connector.WsKlineEvent) {
+		k := event.Kline
+		kline, err := parseCandle(time.UnixMilli(k.StartTime), k.Open, k.High, k.Low, k.Close)
+		if err == nil {
+			err = parseVolume(&kline, k.Volume, k.QuoteVolume)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("market", event.Symbol).Error("cannot parse kline")
+			return
+		}
+		for _, market := range b.list() {
+			if strings.EqualFold(b.getChartTicker(market), event.Symbol) {
+				b.mu.Lock()
+				// the 5m kline starting after midnight opens the new daily candle
+				market.mergeKline(kline)
+				market.updateTimeframes(kline.Close)
+				market.LastUpdate = time.Now()
+				m := market.Snapshot()
+				b.mu.Unlock()
+				send(ctx, update, m)
+			}
+		}
+	}
+}
+
+// bookTickerHandler updates the best bid and ask of the markets.
+// The book changes many times a second, an update is sent at most every bookTickerInterval.
+func (b *binance) bookTickerHandler(ctx context.Context, update chan<- Market) func(event *binance_connector.WsBookTickerEvent) {
+	return func(event *binance_connector.WsBookTickerEvent) {
+		var book BookTicker
+		for _, v := range []struct {
+			value *float64
+			s     string
+		}{
+			{&book.Bid, event.BestBidPrice},
+			{&book.BidQty, event.BestBidQty},
+			{&book.Ask, event.BestAskPrice},
+			{&book.AskQty, event.BestAskQty},
+		} {
+			var err error
+			*v.value, err = strconv.ParseFloat(v.s, 64)
+			if err != nil {
+				logrus.WithError(err).WithField("market", event.Symbol).Error("cannot parse book ticker")
+				return
+			}
+		}
+
+		for _, market := range b.list() {
+			if strings.EqualFold(b.getChartTicker(market), event.Symbol) {
+				b.mu.Lock()
+				market.Book = book
+				due := time.Since(market.LastUpdate) >= bookTickerInterval
+				if due {
+					market.LastUpdate = time.Now()
+				}
+				m := market.Snapshot()
+				b.mu.Unlock()
+				if due {
+					send(ctx, update, m)
+				}
+			}
+		}
+	}
+}
+
+// stopStream stops a websocket stream unless it is already done
+func stopStream(doneC, stopC chan struct{}) {
+	select {
+	case stopC <- struct{}{}:
+	case <-doneC:
 	}
 }
+
+func NewBinance() Exchange {
+	return &binance{}
+}
@@ -0,0 +1,340 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	binanceFuturesRESTURL      = "https://fapi.binance.com"
+	binanceFuturesWebsocketURL = "wss://fstream.binance.com"
+)
+
+// binanceFutures streams USD-M perpetual contracts
+type binanceFutures struct {
+	wsMarkets
+	endpoints Endpoints
+	state     sync.Mutex // guards the market fields between the stream and the refresh
+}
+
+type binanceFuturesPremiumIndex struct {
+	MarkPrice       string `json:"markPrice"`
+	IndexPrice      string `json:"indexPrice"`
+	LastFundingRate string `json:"lastFundingRate"`
+	NextFundingTime int64  `json:"nextFundingTime"`
+}
+
+type binanceFuturesMessage struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type binanceFuturesMarkPrice struct {
+	Symbol          string `json:"s"`
+	MarkPrice       string `json:"p"`
+	IndexPrice      string `json:"i"`
+	FundingRate     string `json:"r"`
+	NextFundingTime int64  `json:"T"`
+}
+
+type binanceFuturesTicker24hr struct {
+	OpenPrice   string `json:"openPrice"`
+	HighPrice   string `json:"highPrice"`
+	LowPrice    string `json:"lowPrice"`
+	LastPrice   string `json:"lastPrice"`
+	OpenTime    int64  `json:"openTime"`
+	Volume      string `json:"volume"`
+	QuoteVolume string `json:"quoteVolume"`
+}
+
+type binanceFuturesKline struct {
+	Symbol string `json:"s"`
+	Kline  struct {
+		StartTime   int64  `json:"t"`
+		Open        string `json:"o"`
+		High        string `json:"h"`
+		Low         string `json:"l"`
+		Close       string `json:"c"`
+		Volume      string `json:"v"`
+		QuoteVolume string `json:"q"`
+	} `json:"k"`
+}
+
+func (b *binanceFutures) getSymbol(market *Market) string {
+	return strings.ToUpper(market.Base + market.Quote)
+}
+
+// fetchCandle returns the candle of the reference period, the rolling 24h candle comes from the 24hr ticker
+func (b *binanceFutures) fetchCandle(ctx context.Context, market *Market, period Period) (Candle, error) {
+	symbol := b.getSymbol(market)
+
+	if period.Rolling() {
+		var t binanceFuturesTicker24hr
+		url := fmt.Sprintf("%s/fapi/v1/ticker/24hr?symbol=%s", b.endpoints.REST, symbol)
+		err := httpGetJSONContext(ctx, url, &t)
+		if err != nil {
+			return Candle{}, err
+		}
+		candle, err := parseCandle(time.UnixMilli(t.OpenTime), t.OpenPrice, t.HighPrice, t.LowPrice, t.LastPrice)
+		if err != nil {
+			return Candle{}, err
+		}
+		candle.Period = period
+		return candle, parseVolume(&candle, t.Volume, t.QuoteVolume)
+	}
+
+	return periodCandle(period, time.Now(), b.klines(ctx, market))
+}
+
+// klines returns a function fetching the klines of the market from start, oldest first
+func (b *binanceFutures) klines(ctx context.Context, market *Market) func(interval string, start time.Time) ([]Candle, error) {
+	symbol := b.getSymbol(market)
+
+	return func(interval string, start time.Time) ([]Candle, error) {
+		// [openTime, open, high, low, close, volume, closeTime, quoteVolume, ...]
+		var result [][]interface{}
+		url := fmt.Sprintf("%s/fapi/v1/klines?symbol=%s&interval=%s&startTime=%d&limit=1000", b.endpoints.REST, symbol, interval, start.UnixMilli())
+		err := httpGetJSONContext(ctx, url, &result)
+		if err != nil {
+			return nil, err
+		}
+		klines := make([]Candle, 0, len(result))
+		for _, k := range result {
+			if len(k) < 8 {
+				return nil, fmt.Errorf("invalid kline for %s", symbol)
+			}
+			openTime, _ := strconv.ParseFloat(fmt.Sprint(k[0]), 64)
+			kline, err := parseCandle(time.UnixMilli(int64(openTime)), fmt.Sprint(k[1]), fmt.Sprint(k[2]), fmt.Sprint(k[3]), fmt.Sprint(k[4]))
+			if err != nil {
+				return nil, err
+			}
+			err = parseVolume(&kline, fmt.Sprint(k[5]), fmt.Sprint(k[7]))
+			if err != nil {
+				return nil, err
+			}
+			klines = append(klines, kline)
+		}
+		return klines, nil
+	}
+}
+
+func (b *binanceFutures) initMarket(ctx context.Context, market *Market) error {
+	b.state.Lock()
+	period := market.Candle.Period
+	names := market.timeframeNames()
+	b.state.Unlock()
+
+	candle, err := b.fetchCandle(ctx, market, period)
+	if err != nil {
+		return err
+	}
+	// the timeframes are extras, the market is tracked without them
+	timeframes, timeframesErr := fetchTimeframes(names, time.Now(), b.klines(ctx, market))
+	if timeframesErr != nil {
+		logrus.WithError(timeframesErr).WithField("market", market.Key()).Warn("cannot fetch timeframes")
+	}
+	var index binanceFuturesPremiumIndex
+	url := fmt.Sprintf("%s/fapi/v1/premiumIndex?symbol=%s", b.endpoints.REST, b.getSymbol(market))
+	err = httpGetJSONContext(ctx, url, &index)
+	if err != nil {
+		return err
+	}
+
+	b.state.Lock()
+	defer b.state.Unlock()
+	if timeframesErr == nil {
+		market.Timeframes = timeframes
+	}
+	// the stream may have started a newer candle since the request
+	if !candle.Start.Before(market.Candle.Start) {
+		market.Candle = candle
+		market.streamed = Candle{}
+	}
+	b.updateFutures(market, index.MarkPrice, index.IndexPrice, index.LastFundingRate, index.NextFundingTime)
+	market.LastUpdate = time.Now()
+	return nil
+}
+
+func (b *binanceFutures) updateFutures(market *Market, markPrice, indexPrice, fundingRate string, nextFundingTime int64) {
+	market.Futures.MarkPrice, _ = strconv.ParseFloat(markPrice, 64)
+	market.Futures.IndexPrice, _ = strconv.ParseFloat(indexPrice, 64)
+	market.Futures.FundingRate, _ = strconv.ParseFloat(fundingRate, 64)
+	market.Futures.NextFundingTime = time.UnixMilli(nextFundingTime)
+}
+
+func (b *binanceFutures) Register(base string, quote string) error {
+	return b.RegisterWithOptions(base, quote, nil)
+}
+
+// RegisterWithOptions accepts the period (24h, 1h, 4h, day, week, month), tz (e.g. Europe/Berlin)
+// and timeframes (e.g. 1h,24h,7d,30d) options
+func (b *binanceFutures) RegisterWithOptions(base string, quote string, options url.Values) error {
+	period, err := ParsePeriod(options)
+	if err != nil {
+		return fmt.Errorf("binance-futures: %w", err)
+	}
+	names, err := ParseTimeframes(options)
+	if err != nil {
+		return fmt.Errorf("binance-futures: %w", err)
+	}
+	market := newMarket("binance-futures", base, quote)
+	market.Candle.Period = period
+	for _, name := range names {
+		market.Timeframes = append(market.Timeframes, Timeframe{Name: name})
+	}
+	b.markets = append(b.markets, market)
+	return nil
+}
+
+func (b *binanceFutures) Subscribe(base string, quote string) error {
+	market := newMarket("binance-futures", base, quote)
+	market.Candle.Period = UTCDay
+	err := b.initMarket(b.connContext(), market)
+	if err != nil {
+		return err
+	}
+	return b.add(market, b.subscribeMessage("SUBSCRIBE"))
+}
+
+func (b *binanceFutures) Unsubscribe(base string, quote string) error {
+	return b.remove(base, quote, b.subscribeMessage("UNSUBSCRIBE"))
+}
+
+func (b *binanceFutures) subscribeMessage(method string) func(markets []*Market) interface{} {
+	return func(markets []*Market) interface{} {
+		streams := make([]string, 0, len(markets)*2)
+		for _, market := range markets {
+			symbol := strings.ToLower(b.getSymbol(market))
+			streams = append(streams, symbol+"@markPrice@1s", symbol+"@kline_5m")
+		}
+		return map[string]interface{}{
+			"method": method,
+			"params": streams,
+			"id":     1,
+		}
+	}
+}
+
+func (b *binanceFutures) handleMessage(ctx context.Context, msg []byte, update chan<- Market) error {
+	var event binanceFuturesMessage
+	err := json.Unmarshal(msg, &event)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case strings.Contains(event.Stream, "@markPrice"):
+		var data binanceFuturesMarkPrice
+		err = json.Unmarshal(event.Data, &data)
+		if err != nil {
+			return err
+		}
+		for _, market := range b.list() {
+			if strings.EqualFold(b.getSymbol(market), data.Symbol) {
+				b.state.Lock()
+				b.updateFutures(market, data.MarkPrice, data.IndexPrice, data.FundingRate, data.NextFundingTime)
+				market.LastUpdate = time.Now()
+				m := market.Snapshot()
+				b.state.Unlock()
+				send(ctx, update, m)
+			}
+		}
+	case strings.Contains(event.Stream, "@kline"):
+		var data binanceFuturesKline
+		err = json.Unmarshal(event.Data, &data)
+		if err != nil {
+			return err
+		}
+		k := data.Kline
+		kline, err := parseCandle(time.UnixMilli(k.StartTime), k.Open, k.High, k.Low, k.Close)
+		if err == nil {
+			err = parseVolume(&kline, k.Volume, k.QuoteVolume)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("market", data.Symbol).Error("cannot parse kline")
+			return nil
+		}
+		for _, market := range b.list() {
+			if strings.EqualFold(b.getSymbol(market), data.Symbol) {
+				b.state.Lock()
+				// the 5m kline starting after midnight opens the new daily candle
+				market.mergeKline(kline)
+				market.updateTimeframes(kline.Close)
+				market.LastUpdate = time.Now()
+				m := market.Snapshot()
+				b.state.Unlock()
+				send(ctx, update, m)
+			}
+		}
+	}
+	return nil
+}
+
+// History returns the close prices of the 1m klines since from
+func (b *binanceFutures) History(ctx context.Context, base string, quote string, from time.Time) ([]PricePoint, error) {
+	return fetchHistory(from, b.klines(ctx, newMarket("binance-futures", base, quote)))
+}
+
+// Ping checks that the rest api is reachable
+func (b *binanceFutures) Ping(ctx context.Context) error {
+	return httpPing(ctx, fmt.Sprintf("%s/fapi/v1/ping", b.endpoints.REST))
+}
+
+func (b *binanceFutures) Start(ctx context.Context, update chan<- Market) error {
+	refresh := time.Hour
+	for _, market := range b.list() {
+		err := b.initMarket(ctx, market)
+		if err != nil {
+			return err
+		}
+		b.state.Lock()
+		m := market.Snapshot()
+		b.state.Unlock()
+		if !send(ctx, update, m) {
+			return ctx.Err()
+		}
+		// the rolling windows move, the refresh drops their old highs and lows
+		if m.Candle.Period.Rolling() || len(m.Timeframes) > 0 {
+			refresh = time.Minute * 5
+		}
+	}
+	runEvery(ctx, refresh, func() {
+		if !sleep(ctx, time.Second*10) {
+			return
+		}
+		for _, market := range b.list() {
+			b.initMarket(ctx, market)
+		}
+	})
+
+	conn, err := dialWebsocket(ctx, b.endpoints.Websocket+"/stream")
+	if err != nil {
+		return err
+	}
+	defer b.disconnect()
+
+	err = b.connect(ctx, conn, update, b.subscribeMessage("SUBSCRIBE"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return conn.Serve(ctx, func(msg []byte) error {
+		return b.handleMessage(ctx, msg, update)
+	})
+}
+
+// NewBinanceFutures returns a Binance USD-M futures exchange. Empty endpoints use the public Binance api.
+func NewBinanceFutures(endpoints Endpoints) Exchange {
+	return &binanceFutures{
+		endpoints: endpoints.withDefaults(binanceFuturesRESTURL, binanceFuturesWebsocketURL),
+	}
+}
@@ -0,0 +1,198 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	binance_connector "github.com/binance/binance-connector-go"
+	"github.com/cenkalti/backoff"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// binanceDepthLimit is the number of levels per side of the order book snapshot, the most served.
+	// Fewer levels often end within ±1% of the mid price.
+	binanceDepthLimit = 5000
+	// binanceDepthBuffer is the number of diffs buffered while the snapshot is fetched, 100s of the 100ms stream
+	binanceDepthBuffer = 1000
+	// binanceDepthURL serves the order book snapshots, a snapshot of binanceDepthLimit levels weighs 250 of the 6000 per minute
+	binanceDepthURL = "https://api.binance.com/api/v3/depth"
+)
+
+// retryAfterError is a response asking to wait before the next request, e.g. 429 Too Many Requests or 418 after a ban
+type retryAfterError struct {
+	status string
+	wait   time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("unexpected status: %s, retry after %s", e.status, e.wait)
+}
+
+// binanceDepthUpdate is a diff of the depth stream covering the updates from first to last
+type binanceDepthUpdate struct {
+	first int64
+	last  int64
+	bids  []OrderBookLevel
+	asks  []OrderBookLevel
+}
+
+// binanceOrderBook keeps the order book of a symbol in sync with a rest snapshot and the diff depth stream.
+// See "How to manage a local order book correctly" in the Binance api docs.
+type binanceOrderBook struct {
+	*orderBook
+	symbol  string
+	updates chan binanceDepthUpdate
+}
+
+func newBinanceOrderBook(symbol string) *binanceOrderBook {
+	return &binanceOrderBook{
+		orderBook: &orderBook{},
+		symbol:    symbol,
+		updates:   make(chan binanceDepthUpdate, binanceDepthBuffer),
+	}
+}
+
+// push buffers a diff of the stream without blocking it. A dropped diff leaves a gap which resyncs the book.
+func (o *binanceOrderBook) push(event *binance_connector.WsDepthEvent) {
+	bids, err := parseLevels(event.Bids)
+	if err != nil {
+		logrus.WithError(err).WithField("market", o.symbol).Error("cannot parse depth update")
+		return
+	}
+	asks, err := parseLevels(event.Asks)
+	if err != nil {
+		logrus.WithError(err).WithField("market", o.symbol).Error("cannot parse depth update")
+		return
+	}
+
+	select {
+	case o.updates <- binanceDepthUpdate{first: event.FirstUpdateID, last: event.LastUpdateID, bids: bids, asks: asks}:
+	default:
+	}
+}
+
+func parseLevels(levels []binance_connector.PriceLevel) ([]OrderBookLevel, error) {
+	parsed := make([]OrderBookLevel, 0, len(levels))
+	for _, level := range levels {
+		price, err := strconv.ParseFloat(level.Price, 64)
+		if err != nil {
+			return nil, err
+		}
+		quantity, err := strconv.ParseFloat(level.Quantity, 64)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, OrderBookLevel{Price: price, Quantity: quantity})
+	}
+	return parsed, nil
+}
+
+// run syncs the book until ctx is done. The book is resynced from a new snapshot when an update is lost.
+// The snapshots are heavy, the resyncs back off exponentially and wait at least as long as the api asks for.
+func (o *binanceOrderBook) run(ctx context.Context) {
+	bf := backoff.NewExponentialBackOff()
+	bf.MaxInterval = 5 * time.Minute
+	bf.MaxElapsedTime = 0
+	for {
+		err := o.fetchSnapshot(ctx)
+		if err == nil {
+			synced := time.Now()
+			err = o.follow(ctx)
+			// a book which stayed in sync for a while resyncs without waiting long
+			if time.Since(synced) >= time.Minute {
+				bf.Reset()
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		wait := bf.NextBackOff()
+		var retryAfter *retryAfterError
+		if errors.As(err, &retryAfter) && retryAfter.wait > wait {
+			wait = retryAfter.wait
+		}
+		logrus.WithError(err).WithField("market", o.symbol).WithField("wait", wait).Warn("order book out of sync, resyncing")
+		o.invalidate()
+		if !sleep(ctx, wait) {
+			return
+		}
+	}
+}
+
+// follow applies the buffered and streamed diffs to the snapshot.
+// It returns an error when a diff does not continue the book, e.g. after a dropped diff or a snapshot older than the buffer.
+func (o *binanceOrderBook) follow(ctx context.Context) error {
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case update := <-o.updates:
+			last := o.lastUpdateID()
+			// the snapshot already contains the update
+			if update.last <= last {
+				continue
+			}
+			// the first diff must contain the update after the snapshot, every later diff must continue the previous one
+			if (first && update.first > last+1) || (!first && update.first != last+1) {
+				return fmt.Errorf("depth update %d-%d does not follow %d", update.first, update.last, last)
+			}
+			o.update(update.last, update.bids, update.asks)
+			first = false
+		}
+	}
+}
+
+// fetchSnapshot replaces the book with the rest snapshot.
+// It is requested without the connector, which hides the Retry-After header of a rate limited response.
+func (o *binanceOrderBook) fetchSnapshot(ctx context.Context) error {
+	url := fmt.Sprintf("%s?symbol=%s&limit=%d", binanceDepthURL, o.symbol, binanceDepthLimit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &retryAfterError{status: resp.Status, wait: time.Duration(seconds) * time.Second}
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var snapshot struct {
+		LastUpdateID int64       `json:"lastUpdateId"`
+		Bids         [][2]string `json:"bids"`
+		Asks         [][2]string `json:"asks"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&snapshot)
+	if err != nil {
+		return err
+	}
+
+	var sides [2][]OrderBookLevel
+	for i, levels := range [][][2]string{snapshot.Bids, snapshot.Asks} {
+		parsed := make([]binance_connector.PriceLevel, 0, len(levels))
+		for _, level := range levels {
+			parsed = append(parsed, binance_connector.PriceLevel{Price: level[0], Quantity: level[1]})
+		}
+		sides[i], err = parseLevels(parsed)
+		if err != nil {
+			return err
+		}
+	}
+	o.reset(snapshot.LastUpdateID, sides[0], sides[1])
+	return nil
+}
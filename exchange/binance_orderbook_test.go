@@ -0,0 +1,73 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBinanceOrderBookFollow(t *testing.T) {
+	tests := []struct {
+		name     string
+		updates  []binanceDepthUpdate
+		wantSync bool  // follow keeps the book until the context is done
+		wantID   int64 // last update applied to the book
+	}{
+		{
+			name:     "first diff straddles the snapshot",
+			updates:  []binanceDepthUpdate{{first: 95, last: 105}, {first: 106, last: 110}},
+			wantSync: true,
+			wantID:   110,
+		},
+		{
+			name:     "first diff right after the snapshot",
+			updates:  []binanceDepthUpdate{{first: 101, last: 105}},
+			wantSync: true,
+			wantID:   105,
+		},
+		{
+			name:     "stale diffs are skipped",
+			updates:  []binanceDepthUpdate{{first: 80, last: 90}, {first: 91, last: 100}, {first: 101, last: 104}},
+			wantSync: true,
+			wantID:   104,
+		},
+		{
+			name:    "first diff after a gap",
+			updates: []binanceDepthUpdate{{first: 102, last: 110}},
+			wantID:  100,
+		},
+		{
+			name:    "gap between diffs",
+			updates: []binanceDepthUpdate{{first: 95, last: 105}, {first: 107, last: 110}},
+			wantID:  105,
+		},
+		{
+			name:    "overlapping diff after the first",
+			updates: []binanceDepthUpdate{{first: 95, last: 105}, {first: 104, last: 110}},
+			wantID:  105,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := newBinanceOrderBook("BTCUSDT")
+			book.reset(100, []OrderBookLevel{{Price: 99, Quantity: 1}}, []OrderBookLevel{{Price: 101, Quantity: 1}})
+			for _, update := range test.updates {
+				book.updates <- update
+			}
+
+			// the buffered diffs are applied long before the timeout
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := book.follow(ctx)
+
+			if synced := errors.Is(err, context.DeadlineExceeded); synced != test.wantSync {
+				t.Errorf("follow() error = %v, want in sync %v", err, test.wantSync)
+			}
+			if id := book.lastUpdateID(); id != test.wantID {
+				t.Errorf("last update id = %d, want %d", id, test.wantID)
+			}
+		})
+	}
+}
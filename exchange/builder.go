@@ -0,0 +1,79 @@
+package exchange
+
+import (
+	"time"
+)
+
+// DefaultBuilderPeriods are the candles built when no period is given to NewCandleBuilder
+var DefaultBuilderPeriods = []Period{UTCMinute, UTCFiveMinutes, UTCHour, UTCDay}
+
+// CandleBuilder builds the candles of several periods from price updates,
+// e.g. for sources which only know the last price. It is not safe for concurrent use.
+type CandleBuilder struct {
+	candles []Candle // current candle of every period, zero before the first price
+}
+
+// NewCandleBuilder builds candles of the given periods, DefaultBuilderPeriods when empty.
+// Rolling periods have no boundaries, so they are not supported.
+func NewCandleBuilder(periods ...Period) *CandleBuilder {
+	if len(periods) == 0 {
+		periods = DefaultBuilderPeriods
+	}
+	builder := &CandleBuilder{candles: make([]Candle, 0, len(periods))}
+	for _, period := range periods {
+		if period.bounded() {
+			builder.candles = append(builder.candles, Candle{Period: period})
+		}
+	}
+	return builder
+}
+
+// Update adds the price seen at t and returns the candles it completed, e.g. the last minute at the first price of a new minute.
+// Prices older than the current candles are ignored.
+func (b *CandleBuilder) Update(t time.Time, price float64) []Candle {
+	var completed []Candle
+	for i := range b.candles {
+		candle := &b.candles[i]
+		switch {
+		case candle.Start.IsZero():
+			*candle = NewCandle(t, candle.Period, price)
+		case t.Before(candle.Start):
+			continue
+		case candle.isAfter(t):
+			completed = append(completed, *candle)
+			candle.rollover(t, price)
+		default:
+			candle.Update(price)
+		}
+	}
+	return completed
+}
+
+// AddVolume adds the volume traded since the last update to the current candles
+func (b *CandleBuilder) AddVolume(volume, quoteVolume float64) {
+	for i := range b.candles {
+		b.candles[i].Volume += volume
+		b.candles[i].QuoteVolume += quoteVolume
+	}
+}
+
+// Candle returns the current candle of the period
+func (b *CandleBuilder) Candle(period Period) (Candle, bool) {
+	for _, candle := range b.candles {
+		if candle.Period == period && !candle.Start.IsZero() {
+			return candle, true
+		}
+	}
+	return Candle{}, false
+}
+
+// Candles returns the current candle of every period which had a price
+func (b *CandleBuilder) Candles() []Candle {
+	candles := make([]Candle, 0, len(b.candles))
+	for _, candle := range b.candles {
+		if !candle.Start.IsZero() {
+			candles = append(candles, candle)
+		}
+	}
+	return candles
+}
@@ -0,0 +1,91 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCandleBuilderUpdate(t *testing.T) {
+	start := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	type update struct {
+		at     time.Duration // since start
+		price  float64
+		volume float64 // base volume traded since the last update
+	}
+
+	tests := []struct {
+		name          string
+		periods       []Period
+		updates       []update
+		wantCompleted []Candle // candles completed by the updates, in order
+	}{
+		{
+			name:    "prices within the minute",
+			periods: []Period{UTCMinute},
+			updates: []update{{0, 100, 1}, {30 * time.Second, 105, 2}, {59 * time.Second, 99, 1}},
+		},
+		{
+			name:    "first price of the next minute",
+			periods: []Period{UTCMinute},
+			updates: []update{{0, 100, 1}, {30 * time.Second, 105, 2}, {time.Minute, 103, 4}},
+			wantCompleted: []Candle{
+				{Open: 100, High: 105, Low: 100, Close: 105, Volume: 3, QuoteVolume: 310, Start: start, Period: UTCMinute},
+			},
+		},
+		{
+			name:    "new hour completes the shorter periods",
+			updates: []update{{59*time.Minute + 30*time.Second, 100, 1}, {time.Hour + 10*time.Second, 101, 1}},
+			wantCompleted: []Candle{
+				{Open: 100, High: 100, Low: 100, Close: 100, Volume: 1, QuoteVolume: 100, Start: start.Add(59 * time.Minute), Period: UTCMinute},
+				{Open: 100, High: 100, Low: 100, Close: 100, Volume: 1, QuoteVolume: 100, Start: start.Add(55 * time.Minute), Period: UTCFiveMinutes},
+				{Open: 100, High: 100, Low: 100, Close: 100, Volume: 1, QuoteVolume: 100, Start: start, Period: UTCHour},
+			},
+		},
+		{
+			name:    "gap completes the last candle once",
+			periods: []Period{UTCMinute},
+			updates: []update{{0, 100, 1}, {5 * time.Minute, 110, 1}},
+			wantCompleted: []Candle{
+				{Open: 100, High: 100, Low: 100, Close: 100, Volume: 1, QuoteVolume: 100, Start: start, Period: UTCMinute},
+			},
+		},
+		{
+			name:    "older price is ignored",
+			periods: []Period{UTCMinute},
+			updates: []update{{time.Minute, 100, 1}, {30 * time.Second, 90, 0}, {2 * time.Minute, 95, 1}},
+			wantCompleted: []Candle{
+				{Open: 100, High: 100, Low: 100, Close: 100, Volume: 1, QuoteVolume: 100, Start: start.Add(time.Minute), Period: UTCMinute},
+			},
+		},
+		{
+			name:    "rolling period is not built",
+			periods: []Period{Rolling24h, UTCMinute},
+			updates: []update{{0, 100, 0}, {time.Minute, 101, 0}},
+			wantCompleted: []Candle{
+				{Open: 100, High: 100, Low: 100, Close: 100, Start: start, Period: UTCMinute},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := NewCandleBuilder(test.periods...)
+			var completed []Candle
+			for _, u := range test.updates {
+				// the aggregator adds the traded volume after the price, so it counts in the new candle
+				completed = append(completed, builder.Update(start.Add(u.at), u.price)...)
+				builder.AddVolume(u.volume, u.volume*u.price)
+			}
+
+			if len(completed) != len(test.wantCompleted) {
+				t.Fatalf("completed %d candles %+v, want %d", len(completed), completed, len(test.wantCompleted))
+			}
+			for i, candle := range completed {
+				want := test.wantCompleted[i]
+				if !sameCandle(candle, want) || candle.Period != want.Period {
+					t.Errorf("completed[%d] = %+v, want %+v", i, candle, want)
+				}
+			}
+		})
+	}
+}
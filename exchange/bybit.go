@@ -0,0 +1,194 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	bybitRESTURL      = "https://api.bybit.com"
+	bybitWebsocketURL = "wss://stream.bybit.com/v5/public/spot"
+)
+
+type bybit struct {
+	wsMarkets
+	endpoints Endpoints
+	state     sync.Mutex // guards the market fields between the stream and the refresh
+}
+
+type bybitKlineResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		// [startTime, open, high, low, close, volume, turnover], newest candle first
+		List [][]string `json:"list"`
+	} `json:"result"`
+}
+
+type bybitMessage struct {
+	Op      string `json:"op"`
+	Success *bool  `json:"success"`
+	RetMsg  string `json:"ret_msg"`
+	Topic   string `json:"topic"`
+	Data    struct {
+		Symbol    string `json:"symbol"`
+		LastPrice string `json:"lastPrice"`
+	} `json:"data"`
+}
+
+func (b *bybit) getSymbol(market *Market) string {
+	return strings.ToUpper(market.Base + market.Quote)
+}
+
+func (b *bybit) initMarket(market *Market) error {
+	var resp bybitKlineResponse
+	url := fmt.Sprintf("%s/v5/market/kline?category=spot&symbol=%s&interval=D&limit=1", b.endpoints.REST, b.getSymbol(market))
+	err := httpGetJSON(url, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return fmt.Errorf("bybit: %s", resp.RetMsg)
+	}
+	if len(resp.Result.List) == 0 || len(resp.Result.List[0]) < 5 {
+		return fmt.Errorf("no daily candle for %s", b.getSymbol(market))
+	}
+	candle := resp.Result.List[0]
+	start, _ := strconv.ParseInt(candle[0], 10, 64)
+	parsed := Candle{Start: time.UnixMilli(start), Period: UTCDay}
+	parsed.Open, _ = strconv.ParseFloat(candle[1], 64)
+	parsed.High, _ = strconv.ParseFloat(candle[2], 64)
+	parsed.Low, _ = strconv.ParseFloat(candle[3], 64)
+	parsed.Close, _ = strconv.ParseFloat(candle[4], 64)
+	if len(candle) >= 7 {
+		// the turnover is the quote volume
+		parseVolume(&parsed, candle[5], candle[6])
+	}
+
+	b.state.Lock()
+	defer b.state.Unlock()
+	market.Candle = parsed
+	market.LastUpdate = time.Now()
+	return nil
+}
+
+func (b *bybit) Register(base string, quote string) error {
+	b.markets = append(b.markets, newMarket("bybit", base, quote))
+	return nil
+}
+
+func (b *bybit) Subscribe(base string, quote string) error {
+	market := newMarket("bybit", base, quote)
+	err := b.initMarket(market)
+	if err != nil {
+		return err
+	}
+	return b.add(market, b.subscribeMessage("subscribe"))
+}
+
+func (b *bybit) Unsubscribe(base string, quote string) error {
+	return b.remove(base, quote, b.subscribeMessage("unsubscribe"))
+}
+
+func (b *bybit) subscribeMessage(op string) func(markets []*Market) interface{} {
+	return func(markets []*Market) interface{} {
+		topics := make([]string, 0, len(markets))
+		for _, market := range markets {
+			topics = append(topics, "tickers."+b.getSymbol(market))
+		}
+		return map[string]interface{}{
+			"op":   op,
+			"args": topics,
+		}
+	}
+}
+
+// Ping checks that the rest api is reachable
+func (b *bybit) Ping(ctx context.Context) error {
+	return httpPing(ctx, fmt.Sprintf("%s/v5/market/time", b.endpoints.REST))
+}
+
+func (b *bybit) Start(ctx context.Context, update chan<- Market) error {
+	for _, market := range b.list() {
+		err := b.initMarket(market)
+		if err != nil {
+			return err
+		}
+		b.state.Lock()
+		m := market.Snapshot()
+		b.state.Unlock()
+		if !send(ctx, update, m) {
+			return ctx.Err()
+		}
+	}
+	runEvery(ctx, time.Hour, func() {
+		if !sleep(ctx, time.Second*10) {
+			return
+		}
+		for _, market := range b.list() {
+			b.initMarket(market)
+		}
+	})
+
+	conn, err := dialWebsocket(ctx, b.endpoints.Websocket)
+	if err != nil {
+		return err
+	}
+	defer b.disconnect()
+
+	err = b.connect(ctx, conn, update, b.subscribeMessage("subscribe"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	// bybit drops the connection without a ping in every 20 seconds
+	conn.KeepAlive(ctx, time.Second*20, func() error {
+		return conn.WriteJSON(map[string]string{"op": "ping"})
+	})
+
+	return conn.Serve(ctx, func(msg []byte) error {
+		var event bybitMessage
+		err := json.Unmarshal(msg, &event)
+		if err != nil {
+			return err
+		}
+		if event.Op == "subscribe" && event.Success != nil && !*event.Success {
+			return fmt.Errorf("bybit: %s", event.RetMsg)
+		}
+		if !strings.HasPrefix(event.Topic, "tickers.") {
+			return nil
+		}
+
+		for _, market := range b.list() {
+			if strings.EqualFold(b.getSymbol(market), event.Data.Symbol) {
+				price, err := strconv.ParseFloat(event.Data.LastPrice, 64)
+				if err != nil {
+					logrus.WithError(err).WithField("market", event.Data.Symbol).Error("cannot parse price")
+					continue
+				}
+				b.state.Lock()
+				market.Candle.UpdateAt(time.Now(), price)
+				market.LastUpdate = time.Now()
+				m := market.Snapshot()
+				b.state.Unlock()
+				send(ctx, update, m)
+			}
+		}
+		return nil
+	})
+}
+
+// NewBybit returns a Bybit spot exchange. Empty endpoints use the public Bybit api.
+func NewBybit(endpoints Endpoints) Exchange {
+	return &bybit{
+		endpoints: endpoints.withDefaults(bybitRESTURL, bybitWebsocketURL),
+	}
+}
@@ -0,0 +1,179 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	coinbaseRESTURL      = "https://api.exchange.coinbase.com"
+	coinbaseWebsocketURL = "wss://ws-feed.exchange.coinbase.com"
+)
+
+type coinbase struct {
+	wsMarkets
+	endpoints Endpoints
+	state     sync.Mutex // guards the market fields between the stream and the refresh
+}
+
+type coinbaseMessage struct {
+	Type      string `json:"type"`
+	ProductID string `json:"product_id"`
+	Price     string `json:"price"`
+	Message   string `json:"message"`
+	Reason    string `json:"reason"`
+}
+
+func (c *coinbase) getProductID(market *Market) string {
+	return strings.ToUpper(market.Base + "-" + market.Quote)
+}
+
+func (c *coinbase) initMarket(market *Market) error {
+	// [time, low, high, open, close, volume], newest candle first
+	var candles [][]float64
+	url := fmt.Sprintf("%s/products/%s/candles?granularity=86400", c.endpoints.REST, c.getProductID(market))
+	err := httpGetJSON(url, &candles)
+	if err != nil {
+		return err
+	}
+	if len(candles) == 0 || len(candles[0]) < 5 {
+		return fmt.Errorf("no daily candle for %s", c.getProductID(market))
+	}
+	candle := Candle{
+		Start:  time.Unix(int64(candles[0][0]), 0),
+		Period: UTCDay,
+		Low:    candles[0][1],
+		High:   candles[0][2],
+		Open:   candles[0][3],
+		Close:  candles[0][4],
+	}
+	// coinbase serves only the base volume
+	if len(candles[0]) >= 6 {
+		candle.Volume = candles[0][5]
+	}
+
+	c.state.Lock()
+	defer c.state.Unlock()
+	market.Candle = candle
+	market.LastUpdate = time.Now()
+	return nil
+}
+
+func (c *coinbase) Register(base string, quote string) error {
+	c.markets = append(c.markets, newMarket("coinbase", base, quote))
+	return nil
+}
+
+func (c *coinbase) Subscribe(base string, quote string) error {
+	market := newMarket("coinbase", base, quote)
+	err := c.initMarket(market)
+	if err != nil {
+		return err
+	}
+	return c.add(market, c.subscribeMessage("subscribe"))
+}
+
+func (c *coinbase) Unsubscribe(base string, quote string) error {
+	return c.remove(base, quote, c.subscribeMessage("unsubscribe"))
+}
+
+func (c *coinbase) subscribeMessage(messageType string) func(markets []*Market) interface{} {
+	return func(markets []*Market) interface{} {
+		productIDs := make([]string, 0, len(markets))
+		for _, market := range markets {
+			productIDs = append(productIDs, c.getProductID(market))
+		}
+		return map[string]interface{}{
+			"type":        messageType,
+			"product_ids": productIDs,
+			"channels":    []string{"ticker"},
+		}
+	}
+}
+
+// Ping checks that the rest api is reachable
+func (c *coinbase) Ping(ctx context.Context) error {
+	return httpPing(ctx, fmt.Sprintf("%s/time", c.endpoints.REST))
+}
+
+func (c *coinbase) Start(ctx context.Context, update chan<- Market) error {
+	for _, market := range c.list() {
+		err := c.initMarket(market)
+		if err != nil {
+			return err
+		}
+		c.state.Lock()
+		m := market.Snapshot()
+		c.state.Unlock()
+		if !send(ctx, update, m) {
+			return ctx.Err()
+		}
+	}
+	runEvery(ctx, time.Hour, func() {
+		if !sleep(ctx, time.Second*10) {
+			return
+		}
+		for _, market := range c.list() {
+			c.initMarket(market)
+		}
+	})
+
+	conn, err := dialWebsocket(ctx, c.endpoints.Websocket)
+	if err != nil {
+		return err
+	}
+	defer c.disconnect()
+
+	err = c.connect(ctx, conn, update, c.subscribeMessage("subscribe"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return conn.Serve(ctx, func(msg []byte) error {
+		var event coinbaseMessage
+		err := json.Unmarshal(msg, &event)
+		if err != nil {
+			return err
+		}
+
+		switch event.Type {
+		case "error":
+			return fmt.Errorf("coinbase: %s %s", event.Message, event.Reason)
+		case "ticker":
+		default:
+			return nil
+		}
+
+		for _, market := range c.list() {
+			if strings.EqualFold(c.getProductID(market), event.ProductID) {
+				price, err := strconv.ParseFloat(event.Price, 64)
+				if err != nil {
+					logrus.WithError(err).WithField("market", event.ProductID).Error("cannot parse price")
+					continue
+				}
+				c.state.Lock()
+				market.Candle.UpdateAt(time.Now(), price)
+				market.LastUpdate = time.Now()
+				m := market.Snapshot()
+				c.state.Unlock()
+				send(ctx, update, m)
+			}
+		}
+		return nil
+	})
+}
+
+// NewCoinbase returns a Coinbase exchange. Empty endpoints use the public Coinbase api.
+func NewCoinbase(endpoints Endpoints) Exchange {
+	return &coinbase{
+		endpoints: endpoints.withDefaults(coinbaseRESTURL, coinbaseWebsocketURL),
+	}
+}
@@ -0,0 +1,110 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ConnectionState is the lifecycle state of an exchange connection
+type ConnectionState int
+
+const (
+	// Connecting means the exchange is started but it has not sent any data yet
+	Connecting ConnectionState = iota
+	// Connected means the exchange has sent data since it was started
+	Connected
+	// Reconnecting means the exchange is stopped and waits for the next start, Err is the reason when it failed
+	Reconnecting
+	// Failed means the exchange is stopped with an error which a reconnect does not fix, e.g. a rejected market.
+	// It starts again when its markets change.
+	Failed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// ConnectionEvent is emitted by the aggregator when the connection state of an exchange changes
+type ConnectionEvent struct {
+	Exchange string
+	State    ConnectionState
+	Time     time.Time
+	Delay    time.Duration // wait before the next start while reconnecting
+	Err      error         // error which stopped the exchange while reconnecting or failed
+}
+
+// connectionEventJSON is the json form of a ConnectionEvent, the error is kept as its message
+type connectionEventJSON struct {
+	Exchange string
+	State    ConnectionState
+	Time     time.Time
+	Delay    time.Duration
+	Err      json.RawMessage `json:",omitempty"`
+}
+
+// MarshalJSON encodes the error of the event as its message, e.g. for the recorder
+func (e ConnectionEvent) MarshalJSON() ([]byte, error) {
+	event := connectionEventJSON{
+		Exchange: e.Exchange,
+		State:    e.State,
+		Time:     e.Time,
+		Delay:    e.Delay,
+	}
+	if e.Err != nil {
+		message, err := json.Marshal(e.Err.Error())
+		if err != nil {
+			return nil, err
+		}
+		event.Err = message
+	}
+	return json.Marshal(event)
+}
+
+// UnmarshalJSON decodes an event encoded by MarshalJSON.
+// The error of older recordings is encoded as an empty object, it is dropped.
+func (e *ConnectionEvent) UnmarshalJSON(data []byte) error {
+	var event connectionEventJSON
+	err := json.Unmarshal(data, &event)
+	if err != nil {
+		return err
+	}
+	*e = ConnectionEvent{
+		Exchange: event.Exchange,
+		State:    event.State,
+		Time:     event.Time,
+		Delay:    event.Delay,
+	}
+	var message string
+	if json.Unmarshal(event.Err, &message) == nil && message != "" {
+		e.Err = errors.New(message)
+	}
+	return nil
+}
+
+// RetryIn returns the remaining time until the next start while reconnecting
+func (e ConnectionEvent) RetryIn() time.Duration {
+	if e.State != Reconnecting {
+		return 0
+	}
+	remaining := time.Until(e.Time.Add(e.Delay))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// ConnectionObserver is implemented by observers which want to know about the connection events of the exchanges
+type ConnectionObserver interface {
+	ConnectionChanged(event ConnectionEvent)
+}
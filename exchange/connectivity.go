@@ -0,0 +1,178 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConnectivityChecker reports whether the internet is reachable.
+// The aggregator uses it to tell a quiet market from a lost connection.
+type ConnectivityChecker interface {
+	Online() bool
+}
+
+// Pinger is implemented by exchanges which can check the reachability of their api
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DefaultTCPTargets are public dns servers accepting tcp connections
+var DefaultTCPTargets = []string{
+	"8.8.8.8:53",        // Google DNS
+	"1.1.1.1:53",        // Cloudflare DNS
+	"9.9.9.9:53",        // Quad9 DNS
+	"208.67.222.222:53", // OpenDNS
+	"8.8.4.4:53",        // Google secondary
+}
+
+// DefaultHTTPTarget answers with an empty response when the internet is reachable
+const DefaultHTTPTarget = "http://connectivitycheck.gstatic.com/generate_204"
+
+type tcpChecker struct {
+	targets []string
+	next    int
+	mu      sync.Mutex
+	timeout time.Duration
+}
+
+// NewTCPChecker dials one of the host:port targets per check, in turn.
+// The default targets are used when none is given.
+func NewTCPChecker(targets ...string) ConnectivityChecker {
+	if len(targets) == 0 {
+		targets = DefaultTCPTargets
+	}
+	return &tcpChecker{
+		targets: targets,
+		timeout: 500 * time.Millisecond,
+	}
+}
+
+func (t *tcpChecker) Online() bool {
+	t.mu.Lock()
+	target := t.targets[t.next]
+	t.next = (t.next + 1) % len(t.targets)
+	t.mu.Unlock()
+
+	conn, err := net.DialTimeout("tcp", target, t.timeout)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+type httpChecker struct {
+	url    string
+	client http.Client
+}
+
+// NewHTTPChecker requests the url, any http response means online.
+// It works behind firewalls and proxies which block the tcp checker.
+func NewHTTPChecker(url string) ConnectivityChecker {
+	if url == "" {
+		url = DefaultHTTPTarget
+	}
+	return &httpChecker{
+		url: url,
+		client: http.Client{
+			Timeout: 2 * time.Second,
+		},
+	}
+}
+
+func (h *httpChecker) Online() bool {
+	resp, err := h.client.Get(h.url)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+type assumeOnline struct{}
+
+// NewAssumeOnlineChecker never checks the connection, the markets are only
+// shown offline when their exchange is disconnected
+func NewAssumeOnlineChecker() ConnectivityChecker {
+	return assumeOnline{}
+}
+
+func (assumeOnline) Online() bool {
+	return true
+}
+
+type pingChecker struct {
+	pinger  Pinger
+	timeout time.Duration
+}
+
+// NewPingChecker is online when the pinger answers, e.g. the aggregator pinging the apis of the running exchanges
+func NewPingChecker(pinger Pinger) ConnectivityChecker {
+	return &pingChecker{
+		pinger:  pinger,
+		timeout: 2 * time.Second,
+	}
+}
+
+func (p *pingChecker) Online() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	return p.pinger.Ping(ctx) == nil
+}
+
+// cachedChecker answers with the result of the last check and starts the next one in the background.
+// The checks take up to seconds, the aggregator loop must not wait for them.
+type cachedChecker struct {
+	checker  ConnectivityChecker
+	mu       sync.Mutex
+	online   bool // online until the first check finished, a lost connection is only reported when checked
+	checking bool
+}
+
+func newCachedChecker(checker ConnectivityChecker) *cachedChecker {
+	return &cachedChecker{checker: checker, online: true}
+}
+
+func (c *cachedChecker) Online() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checking {
+		c.checking = true
+		go func() {
+			online := c.checker.Online()
+			c.mu.Lock()
+			c.online = online
+			c.checking = false
+			c.mu.Unlock()
+		}()
+	}
+	return c.online
+}
+
+// NewConnectivityChecker returns a checker by name: tcp, http, online or exchange.
+// The targets are host:port addresses for tcp and an url for http, empty targets use the defaults.
+// The exchange checker pings the running exchanges of the pinger.
+func NewConnectivityChecker(name string, targets []string, pinger Pinger) (ConnectivityChecker, error) {
+	switch name {
+	case "tcp":
+		return NewTCPChecker(targets...), nil
+	case "http":
+		if len(targets) > 1 {
+			return nil, fmt.Errorf("http connectivity checker accepts one url")
+		}
+		url := ""
+		if len(targets) == 1 {
+			url = targets[0]
+		}
+		return NewHTTPChecker(url), nil
+	case "online":
+		return NewAssumeOnlineChecker(), nil
+	case "exchange":
+		return NewPingChecker(pinger), nil
+	}
+	return nil, fmt.Errorf("unknown connectivity checker: %s", name)
+}
@@ -2,6 +2,8 @@ package exchange
 
 import (
 	"context"
+	"net/url"
+	"time"
 )
 
 // Exchange listens for price changes in realtime
@@ -11,3 +13,72 @@ type Exchange interface {
 	// Start listening for price changes in the registered markets
 	Start(ctx context.Context, update chan<- Market) error
 }
+
+// OptionsRegisterer is implemented by exchanges which accept per market options.
+// The options are given in the market format, e.g. fake:btc-usdt?scenario=crash&seed=42
+type OptionsRegisterer interface {
+	// RegisterWithOptions registers a market to listen for price changes
+	RegisterWithOptions(base string, quote string, options url.Values) error
+}
+
+// Subscriber is implemented by exchanges which can add and remove markets
+// on a live connection, without restarting the exchange
+type Subscriber interface {
+	// Subscribe starts listening for price changes in a new market
+	Subscribe(base string, quote string) error
+	// Unsubscribe stops listening for price changes in a registered market
+	Unsubscribe(base string, quote string) error
+}
+
+// StallTimeouter is implemented by exchanges which update at their own pace, e.g. pollers.
+// StallTimeout returns the longest expected silence of the exchange, 0 disables the stall watchdog.
+type StallTimeouter interface {
+	StallTimeout() time.Duration
+}
+
+// HistoryProvider is implemented by exchanges which can fetch the recent prices of a market, e.g. from klines.
+// The aggregator prefills the price history of a market with them when the market is added.
+type HistoryProvider interface {
+	// History returns the close price of every minute since from, oldest first
+	History(ctx context.Context, base string, quote string, from time.Time) ([]PricePoint, error)
+}
+
+// BookTickerer is implemented by exchanges which can stream the best bid and ask of a market into Market.Book.
+// The aggregator enables it for the markets registered with the book option, e.g. binance:btc-usdt?book=true
+type BookTickerer interface {
+	// EnableBookTicker streams the book ticker of a registered market
+	EnableBookTicker(base string, quote string) error
+}
+
+// OrderBooker is implemented by exchanges which can maintain a local order book of a market.
+// The aggregator enables it for the markets registered with the depth option, e.g. binance:btc-usdt?depth=true
+type OrderBooker interface {
+	// EnableOrderBook maintains the order book of a registered market
+	EnableOrderBook(base string, quote string) error
+	// OrderBook returns the best levels, at most levels per side, and the cumulative depth of a market
+	OrderBook(base string, quote string, levels int) (OrderBookDepth, error)
+}
+
+// PairNormalizer is implemented by exchanges which send a market with other symbols than it was registered with,
+// e.g. kraken:xbt-eur is sent as kraken:btc-eur. The aggregator uses it to find the updates of a removed market.
+type PairNormalizer interface {
+	// NormalizePair returns the base and quote of the updates of a market registered as base-quote
+	NormalizePair(base string, quote string) (string, string)
+}
+
+// Endpoints overrides the base urls of an exchange api.
+// Empty fields fall back to the exchange defaults.
+type Endpoints struct {
+	REST      string
+	Websocket string
+}
+
+func (e Endpoints) withDefaults(rest, websocket string) Endpoints {
+	if e.REST == "" {
+		e.REST = rest
+	}
+	if e.Websocket == "" {
+		e.Websocket = websocket
+	}
+	return e
+}
@@ -0,0 +1,221 @@
+package exchange
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/mattn/go-shellwords"
+	"github.com/sirupsen/logrus"
+)
+
+// execSourceConfig defines a market whose prices are printed by a command
+type execSourceConfig struct {
+	ID       string `json:"id"`       // market key, e.g. exec:otc-usd
+	Cmd      string `json:"cmd"`      // command printing prices to stdout, parsed with shellwords
+	Interval string `json:"interval"` // rerun the command periodically, e.g. 30s. When empty the command runs once
+}
+
+type execSource struct {
+	config   execSourceConfig
+	args     []string
+	interval time.Duration
+	market   *Market
+	builder  *CandleBuilder
+}
+
+// execExchange runs user commands and parses their output as price updates.
+// Every line is either a number or a json object with price and optional open, high, low fields.
+type execExchange struct {
+	configPath string
+	configs    []execSourceConfig
+	sources    []*execSource
+}
+
+func (e *execExchange) loadConfig() error {
+	if e.configs != nil {
+		return nil
+	}
+	data, err := os.ReadFile(e.configPath)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &e.configs)
+}
+
+func (e *execExchange) Register(base string, quote string) error {
+	err := e.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	market := newMarket("exec", base, quote)
+	for _, config := range e.configs {
+		if !strings.EqualFold(config.ID, market.Key()) {
+			continue
+		}
+		args, err := shellwords.Parse(config.Cmd)
+		if err != nil {
+			return fmt.Errorf("%s: %w", config.ID, err)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("%s: cmd is required", config.ID)
+		}
+		var interval time.Duration
+		if config.Interval != "" {
+			interval, err = time.ParseDuration(config.Interval)
+			if err != nil {
+				return fmt.Errorf("%s: %w", config.ID, err)
+			}
+		}
+		e.sources = append(e.sources, &execSource{
+			config:   config,
+			args:     args,
+			interval: interval,
+			market:   market,
+			builder:  NewCandleBuilder(UTCDay),
+		})
+		return nil
+	}
+	return fmt.Errorf("market %s is not defined in %s", market.Key(), e.configPath)
+}
+
+// parseLine updates the market candle from a line of the command output
+func (e *execExchange) parseLine(source *execSource, line string) error {
+	var doc interface{} = line
+	if strings.HasPrefix(line, "{") {
+		err := json.Unmarshal([]byte(line), &doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	var price float64
+	var err error
+	if object, ok := doc.(map[string]interface{}); ok {
+		price, err = jsonPath(object, "price")
+	} else {
+		price, err = strconv.ParseFloat(line, 64)
+	}
+	if err != nil {
+		return err
+	}
+
+	source.builder.Update(time.Now(), price)
+	candle := &source.market.Candle
+	*candle, _ = source.builder.Candle(UTCDay)
+
+	if object, ok := doc.(map[string]interface{}); ok {
+		for key, value := range map[string]*float64{"open": &candle.Open, "high": &candle.High, "low": &candle.Low} {
+			if _, ok := object[key]; ok {
+				*value, err = jsonPath(object, key)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	source.market.LastUpdate = time.Now()
+	return nil
+}
+
+func (e *execExchange) run(ctx context.Context, source *execSource, update chan<- Market) error {
+	log := logrus.WithField("market", source.config.ID)
+
+	cmd := exec.CommandContext(ctx, source.args[0], source.args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		err := e.parseLine(source, line)
+		if err != nil {
+			log.WithError(err).WithField("line", line).Error("cannot parse price")
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case update <- *source.market:
+		}
+	}
+
+	return cmd.Wait()
+}
+
+// Start runs every source. A failed command is logged and rerun at its interval,
+// a long running command is restarted with a backoff. The other sources keep running.
+func (e *execExchange) Start(ctx context.Context, update chan<- Market) error {
+	for _, source := range e.sources {
+		go func() {
+			bf := backoff.NewExponentialBackOff()
+			bf.MaxElapsedTime = 0
+			for {
+				started := time.Now()
+				err := e.run(ctx, source, update)
+				if ctx.Err() != nil {
+					return
+				}
+
+				wait := source.interval
+				if err != nil {
+					if source.interval == 0 {
+						// a command which ran for a while is restarted quickly
+						if time.Since(started) >= time.Minute {
+							bf.Reset()
+						}
+						wait = bf.NextBackOff()
+					}
+					logrus.WithError(err).WithField("market", source.config.ID).WithField("wait", wait).Warn("command failed, retrying")
+				} else if source.interval == 0 {
+					// the command finished and runs only once
+					return
+				}
+
+				if !sleep(ctx, wait) {
+					return
+				}
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// StallTimeout allows two missed runs of the slowest source.
+// Long running commands print at their own pace, so they disable the watchdog.
+func (e *execExchange) StallTimeout() time.Duration {
+	var timeout time.Duration
+	for _, source := range e.sources {
+		if source.interval == 0 {
+			return 0
+		}
+		timeout = max(timeout, 2*source.interval)
+	}
+	return timeout
+}
+
+// NewExec returns an exchange which runs the commands defined in the json config file
+func NewExec(configPath string) Exchange {
+	return &execExchange{
+		configPath: configPath,
+	}
+}
@@ -2,38 +2,319 @@ package exchange
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 )
 
+const fakeTick = time.Millisecond * 100
+
+// fakeState is the state of a fake market which outlives the exchange, so the scenario continues after a reconnect
+type fakeState struct {
+	market *Market
+	rand   *rand.Rand
+	tick   int
+}
+
+// fakeStates keeps the fake markets between the exchange instances of a constructor, a new instance is created on every start
+type fakeStates struct {
+	mu     sync.Mutex
+	states map[string]*fakeState // market key and options - state
+}
+
+// get returns the state of the market, a new one when the market is not known
+func (s *fakeStates) get(key string, create func() *fakeState) *fakeState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[key]
+	if state == nil {
+		state = create()
+		s.states[key] = state
+	}
+	return state
+}
+
+// retain drops the states of the markets which are not in keys, a market added again starts its scenario from the beginning
+func (s *fakeStates) retain(keys map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.states {
+		if !keys[key] {
+			delete(s.states, key)
+		}
+	}
+}
+
+func (s *fakeStates) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+}
+
+// fakeMarket is a market driven by a scenario
+type fakeMarket struct {
+	*fakeState
+	key        string // market key and options of the state
+	scenario   string
+	price      float64
+	volatility float64 // standard deviation of a tick in percent
+	drift      float64 // trend of a tick in percent
+	disconnect time.Duration
+	period     Period
+	book       bool       // generates a best bid and ask around the price
+	depth      *orderBook // generated order book around the price, nil when disabled
+}
+
 type fake struct {
-	markets []*Market
+	mu      sync.Mutex
+	markets []*fakeMarket
+	states  *fakeStates
 }
 
 func (f *fake) Register(base string, quote string) error {
-	f.markets = append(f.markets, newMarket("fake", base, quote))
+	return f.RegisterWithOptions(base, quote, nil)
+}
+
+// RegisterWithOptions accepts the following options:
+// seed (random seed), scenario (walk, crash, trend, flat), price (initial price),
+// volatility (percent per tick), drift (trend percent per tick), disconnect (e.g. 30s),
+// period (24h, 1h, 4h, day, week, month) and tz (e.g. Europe/Berlin)
+func (f *fake) RegisterWithOptions(base string, quote string, options url.Values) error {
+	m := &fakeMarket{
+		scenario:   "walk",
+		price:      1000,
+		volatility: 0.05,
+		drift:      0.01,
+	}
+
+	seed := time.Now().UnixNano()
+	var err error
+	if v := options.Get("seed"); v != "" {
+		seed, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("fake: invalid seed: %w", err)
+		}
+	}
+
+	if v := options.Get("scenario"); v != "" {
+		switch v {
+		case "walk", "crash", "trend", "flat":
+			m.scenario = v
+		default:
+			return fmt.Errorf("fake: unknown scenario %q", v)
+		}
+	}
+
+	floats := []struct {
+		name  string
+		value *float64
+	}{
+		{"price", &m.price},
+		{"volatility", &m.volatility},
+		{"drift", &m.drift},
+	}
+	for _, option := range floats {
+		if v := options.Get(option.name); v != "" {
+			*option.value, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("fake: invalid %s: %w", option.name, err)
+			}
+		}
+	}
+
+	if v := options.Get("disconnect"); v != "" {
+		m.disconnect, err = time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("fake: invalid disconnect: %w", err)
+		}
+	}
+
+	m.period, err = ParsePeriod(options)
+	if err != nil {
+		return fmt.Errorf("fake: %w", err)
+	}
+
+	m.key = "fake:" + base + "-" + quote + "?" + options.Encode()
+	m.fakeState = f.states.get(m.key, func() *fakeState {
+		return &fakeState{
+			market: newMarket("fake", base, quote),
+			rand:   rand.New(rand.NewSource(seed)),
+		}
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.markets = append(f.markets, m)
 	return nil
 }
 
+func (f *fake) Subscribe(base string, quote string) error {
+	return f.Register(base, quote)
+}
+
+func (f *fake) Unsubscribe(base string, quote string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, m := range f.markets {
+		if m.market.Base == base && m.market.Quote == quote {
+			f.markets = append(f.markets[:i], f.markets[i+1:]...)
+			// a market added again starts its scenario from the beginning
+			f.states.remove(m.key)
+			return nil
+		}
+	}
+	return fmt.Errorf("market %s-%s not found", base, quote)
+}
+
+// next returns the price of the next tick
+func (m *fakeMarket) next() float64 {
+	price := m.market.Candle.Close
+	noise := m.rand.NormFloat64() * m.volatility / 100
+	m.tick++
+
+	switch m.scenario {
+	case "flat":
+		return price
+	case "trend":
+		return price * (1 + m.drift/100 + noise/4)
+	case "crash":
+		// every 30 seconds the price drops ~18% in a second and recovers half of it
+		switch phase := m.tick % 300; {
+		case phase >= 200 && phase < 210:
+			return price * 0.98
+		case phase >= 210 && phase < 270:
+			return price * (1.0015 + noise/4)
+		}
+	}
+	return price * (1 + noise)
+}
+
+// volume returns the base volume traded in the last tick, the crash trades twenty times more while dropping
+func (m *fakeMarket) volume() float64 {
+	volume := m.rand.ExpFloat64()
+	if phase := m.tick % 300; m.scenario == "crash" && phase >= 200 && phase < 210 {
+		volume *= 20
+	}
+	return volume
+}
+
+// EnableBookTicker generates a best bid and ask with a spread of 1-3 bps around the price
+func (f *fake) EnableBookTicker(base string, quote string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.markets {
+		if m.market.Base == base && m.market.Quote == quote {
+			m.book = true
+			return nil
+		}
+	}
+	return fmt.Errorf("fake: market %s-%s is not registered", base, quote)
+}
+
+// nextBook returns a book ticker around the price
+func (m *fakeMarket) nextBook() BookTicker {
+	price := m.market.Candle.Close
+	spread := price * (1 + 2*m.rand.Float64()) / 10_000
+	return BookTicker{
+		Bid:    price - spread/2,
+		BidQty: m.rand.ExpFloat64(),
+		Ask:    price + spread/2,
+		AskQty: m.rand.ExpFloat64(),
+	}
+}
+
+// EnableOrderBook generates an order book of 50 levels per side, 5 bps apart around the price
+func (f *fake) EnableOrderBook(base string, quote string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.markets {
+		if m.market.Base == base && m.market.Quote == quote {
+			m.depth = &orderBook{}
+			return nil
+		}
+	}
+	return fmt.Errorf("fake: market %s-%s is not registered", base, quote)
+}
+
+// OrderBook returns the best levels and the cumulative depth of the generated order book
+func (f *fake) OrderBook(base string, quote string, levels int) (OrderBookDepth, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.markets {
+		if m.market.Base == base && m.market.Quote == quote && m.depth != nil {
+			return m.depth.depth(levels)
+		}
+	}
+	return OrderBookDepth{}, fmt.Errorf("fake: order book of %s-%s is not enabled", base, quote)
+}
+
+// nextDepth replaces the generated order book with levels around the price
+func (m *fakeMarket) nextDepth() {
+	price := m.market.Candle.Close
+	step := price * 5 / 10_000
+	bids := make([]OrderBookLevel, 50)
+	asks := make([]OrderBookLevel, 50)
+	for i := range bids {
+		bids[i] = OrderBookLevel{Price: price - step*float64(i+1), Quantity: m.rand.ExpFloat64()}
+		asks[i] = OrderBookLevel{Price: price + step*float64(i+1), Quantity: m.rand.ExpFloat64()}
+	}
+	m.depth.reset(int64(m.tick), bids, asks)
+}
+
 func (f *fake) Start(ctx context.Context, update chan<- Market) error {
-	for _, market := range f.markets {
-		market.Candle.High = float64(rand.Int31n(1000) + 1000)
-		market.Candle.Open = float64(rand.Int31n(1000))
-		market.Candle.Low = float64(rand.Int31n(1000))
-		market.Candle.Update(float64(rand.Int31n(1000)))
+	// the exchange disconnects with the most frequent disconnect of its markets
+	var disconnectAfter time.Duration
+	keys := make(map[string]bool)
+	f.mu.Lock()
+	for _, m := range f.markets {
+		if m.disconnect > 0 && (disconnectAfter == 0 || m.disconnect < disconnectAfter) {
+			disconnectAfter = m.disconnect
+		}
+		keys[m.key] = true
+	}
+	f.mu.Unlock()
+	// every market is registered on start, the others were removed while the exchange was stopped
+	f.states.retain(keys)
+	var disconnect <-chan time.Time
+	if disconnectAfter > 0 {
+		disconnect = time.After(disconnectAfter)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(time.Millisecond * 100):
-			for _, market := range f.markets {
-				market.Candle.Update(market.Candle.Close + 1)
-				if market.Candle.Percent() > 100 {
-					market.Candle.Close = market.Candle.Open
+		case <-disconnect:
+			return fmt.Errorf("fake: scheduled disconnect")
+		case <-time.After(fakeTick):
+			f.mu.Lock()
+			updates := make([]Market, 0, len(f.markets))
+			now := time.Now()
+			for _, m := range f.markets {
+				if m.market.Candle.Open == 0 {
+					m.market.Candle = NewCandle(now, m.period, m.price)
+				}
+				m.market.Candle.UpdateAt(now, m.next())
+				volume := m.volume()
+				m.market.Candle.Volume += volume
+				m.market.Candle.QuoteVolume += volume * m.market.Candle.Close
+				m.market.addTraded(volume, volume*m.market.Candle.Close)
+				if m.book {
+					m.market.Book = m.nextBook()
 				}
-				update <- *market
+				if m.depth != nil {
+					m.nextDepth()
+				}
+				m.market.LastUpdate = now
+				updates = append(updates, m.market.Snapshot())
+			}
+			f.mu.Unlock()
+
+			for _, market := range updates {
+				send(ctx, update, market)
 			}
 		}
 	}
@@ -41,5 +322,14 @@ func (f *fake) Start(ctx context.Context, update chan<- Market) error {
 
 // NewFake returns a test exchange
 func NewFake() Exchange {
-	return &fake{}
+	return newFakeConstructor()()
+}
+
+// newFakeConstructor returns a constructor of test exchanges which share their markets,
+// the scenarios continue after a reconnect of the exchange
+func newFakeConstructor() func() Exchange {
+	states := &fakeStates{states: make(map[string]*fakeState)}
+	return func() Exchange {
+		return &fake{states: states}
+	}
 }
@@ -0,0 +1,126 @@
+package exchange
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// historySize is the number of prices kept per market, a day of minutes
+	historySize = 1440
+	// historyInterval is the time between two prices of the history
+	historyInterval = time.Minute
+)
+
+// PricePoint is the close price of a market at the end of a history interval
+type PricePoint struct {
+	Time  time.Time
+	Price float64
+}
+
+// priceHistory is a ring buffer of the close prices of a market, one per interval
+type priceHistory struct {
+	points   []PricePoint
+	start    int // index of the oldest point
+	size     int
+	interval time.Duration
+}
+
+func newPriceHistory(capacity int, interval time.Duration) *priceHistory {
+	return &priceHistory{
+		points:   make([]PricePoint, capacity),
+		interval: interval,
+	}
+}
+
+// last returns the newest point
+func (h *priceHistory) last() (PricePoint, bool) {
+	if h.size == 0 {
+		return PricePoint{}, false
+	}
+	return h.points[(h.start+h.size-1)%len(h.points)], true
+}
+
+// add records the price at t. Prices in the interval of the newest point replace it.
+func (h *priceHistory) add(t time.Time, price float64) {
+	if last, ok := h.last(); ok {
+		if t.Before(last.Time) {
+			return
+		}
+		if t.Truncate(h.interval).Equal(last.Time.Truncate(h.interval)) {
+			h.points[(h.start+h.size-1)%len(h.points)] = PricePoint{Time: t, Price: price}
+			return
+		}
+	}
+
+	point := PricePoint{Time: t, Price: price}
+	if h.size < len(h.points) {
+		h.points[(h.start+h.size)%len(h.points)] = point
+		h.size++
+		return
+	}
+	// full, overwrite the oldest point
+	h.points[h.start] = point
+	h.start = (h.start + 1) % len(h.points)
+}
+
+// prefill inserts the points older than the oldest point, e.g. the prices fetched from an exchange at startup
+func (h *priceHistory) prefill(points []PricePoint) {
+	current := h.list()
+	h.start, h.size = 0, 0
+	for _, point := range points {
+		if len(current) > 0 && !point.Time.Before(current[0].Time.Truncate(h.interval)) {
+			break
+		}
+		h.add(point.Time, point.Price)
+	}
+	for _, point := range current {
+		h.add(point.Time, point.Price)
+	}
+}
+
+// list returns a copy of the points, oldest first
+func (h *priceHistory) list() []PricePoint {
+	points := make([]PricePoint, 0, h.size)
+	for i := 0; i < h.size; i++ {
+		points = append(points, h.points[(h.start+i)%len(h.points)])
+	}
+	return points
+}
+
+// RecentHistory returns the points of the last window
+func RecentHistory(points []PricePoint, window time.Duration) []PricePoint {
+	if len(points) == 0 {
+		return points
+	}
+	from := points[len(points)-1].Time.Add(-window)
+	for i, point := range points {
+		if point.Time.After(from) {
+			return points[i:]
+		}
+	}
+	return points[len(points):]
+}
+
+// fetchHistory builds the price history since from out of 1m klines.
+// fetch returns the klines of the interval from start, oldest first.
+func fetchHistory(from time.Time, fetch func(interval string, start time.Time) ([]Candle, error)) ([]PricePoint, error) {
+	points := make([]PricePoint, 0, historySize)
+	for start := from.Truncate(historyInterval); start.Before(time.Now()); {
+		klines, err := fetch("1m", start)
+		if err != nil {
+			return nil, err
+		}
+		if len(klines) == 0 {
+			break
+		}
+		for _, kline := range klines {
+			points = append(points, PricePoint{Time: kline.Start, Price: kline.Close})
+		}
+		start = klines[len(klines)-1].Start.Add(historyInterval)
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no klines since %s", from)
+	}
+	return points, nil
+}
@@ -0,0 +1,162 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// httpSourceConfig defines a market polled from a json http api
+type httpSourceConfig struct {
+	ID       string `json:"id"`       // market key, e.g. http:gold-usd
+	URL      string `json:"url"`      // url returning a json document
+	Interval string `json:"interval"` // poll interval, e.g. 30s. Defaults to 1m
+	Price    string `json:"price"`    // json path of the price, e.g. data.0.price
+	Open     string `json:"open"`     // optional json path of the open price
+	High     string `json:"high"`     // optional json path of the high price
+	Low      string `json:"low"`      // optional json path of the low price
+}
+
+type httpSource struct {
+	config   httpSourceConfig
+	interval time.Duration
+	market   *Market
+	builder  *CandleBuilder
+}
+
+// httpPoller is an exchange which polls markets defined in a config file
+type httpPoller struct {
+	configPath string
+	configs    []httpSourceConfig
+	sources    []*httpSource
+}
+
+func (h *httpPoller) loadConfig() error {
+	if h.configs != nil {
+		return nil
+	}
+	data, err := os.ReadFile(h.configPath)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &h.configs)
+}
+
+func (h *httpPoller) Register(base string, quote string) error {
+	err := h.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	market := newMarket("http", base, quote)
+	for _, config := range h.configs {
+		if !strings.EqualFold(config.ID, market.Key()) {
+			continue
+		}
+		if config.URL == "" || config.Price == "" {
+			return fmt.Errorf("%s: url and price are required", config.ID)
+		}
+		interval := time.Minute
+		if config.Interval != "" {
+			interval, err = time.ParseDuration(config.Interval)
+			if err != nil {
+				return fmt.Errorf("%s: %w", config.ID, err)
+			}
+		}
+		h.sources = append(h.sources, &httpSource{
+			config:   config,
+			interval: interval,
+			market:   market,
+			builder:  NewCandleBuilder(UTCDay),
+		})
+		return nil
+	}
+	return fmt.Errorf("market %s is not defined in %s", market.Key(), h.configPath)
+}
+
+func (h *httpPoller) poll(ctx context.Context, source *httpSource) error {
+	var doc interface{}
+	err := httpGetJSONContext(ctx, source.config.URL, &doc)
+	if err != nil {
+		return err
+	}
+
+	price, err := jsonPath(doc, source.config.Price)
+	if err != nil {
+		return err
+	}
+
+	source.builder.Update(time.Now(), price)
+	candle := &source.market.Candle
+	*candle, _ = source.builder.Candle(UTCDay)
+
+	// optional fields overwrite the built values
+	optional := []struct {
+		path  string
+		value *float64
+	}{
+		{source.config.Open, &candle.Open},
+		{source.config.High, &candle.High},
+		{source.config.Low, &candle.Low},
+	}
+	for _, field := range optional {
+		if field.path == "" {
+			continue
+		}
+		*field.value, err = jsonPath(doc, field.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	source.market.LastUpdate = time.Now()
+	return nil
+}
+
+// Start polls every source at its interval. A failed poll is logged and retried at the next interval
+// of that source, the other sources keep their candles.
+func (h *httpPoller) Start(ctx context.Context, update chan<- Market) error {
+	for _, source := range h.sources {
+		go func() {
+			for {
+				err := h.poll(ctx, source)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					logrus.WithError(err).WithField("market", source.config.ID).Warn("poll failed, retrying at the next interval")
+				} else if !send(ctx, update, *source.market) {
+					return
+				}
+
+				if !sleep(ctx, source.interval) {
+					return
+				}
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// StallTimeout allows two missed polls of the slowest source
+func (h *httpPoller) StallTimeout() time.Duration {
+	var timeout time.Duration
+	for _, source := range h.sources {
+		timeout = max(timeout, 2*source.interval)
+	}
+	return timeout
+}
+
+// NewHTTPPoller returns an exchange which polls the markets defined in the json config file
+func NewHTTPPoller(configPath string) Exchange {
+	return &httpPoller{
+		configPath: configPath,
+	}
+}
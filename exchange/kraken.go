@@ -0,0 +1,290 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	krakenRESTURL      = "https://api.kraken.com"
+	krakenWebsocketURL = "wss://ws.kraken.com"
+)
+
+// krakenAssets maps symbols to the asset codes used by Kraken
+var krakenAssets = map[string]string{
+	"btc":  "XBT",
+	"doge": "XDG",
+}
+
+// krakenLegacyAssets maps the X/Z prefixed asset codes returned by the rest api
+var krakenLegacyAssets = map[string]string{
+	"XXBT": "XBT",
+	"XXDG": "XDG",
+	"XETH": "ETH",
+	"XETC": "ETC",
+	"XLTC": "LTC",
+	"XXRP": "XRP",
+	"XXLM": "XLM",
+	"XXMR": "XMR",
+	"XZEC": "ZEC",
+	"XREP": "REP",
+	"XMLN": "MLN",
+	"ZUSD": "USD",
+	"ZEUR": "EUR",
+	"ZGBP": "GBP",
+	"ZCAD": "CAD",
+	"ZJPY": "JPY",
+	"ZAUD": "AUD",
+	"ZCHF": "CHF",
+}
+
+// krakenSymbol converts a Kraken asset code (XBT, XXBT, ZEUR) to a lowercase symbol (btc, eur)
+func krakenSymbol(code string) string {
+	code = strings.ToUpper(code)
+	if legacy, ok := krakenLegacyAssets[code]; ok {
+		code = legacy
+	}
+	for symbol, asset := range krakenAssets {
+		if asset == code {
+			return symbol
+		}
+	}
+	return strings.ToLower(code)
+}
+
+// krakenAsset converts a symbol (btc) to a Kraken asset code (XBT)
+func krakenAsset(symbol string) string {
+	symbol = strings.ToLower(symbol)
+	if asset, ok := krakenAssets[symbol]; ok {
+		return asset
+	}
+	return strings.ToUpper(symbol)
+}
+
+// krakenMatchPair reports whether a Kraken pair name (XBT/EUR, XBTEUR, XXBTZEUR) belongs to the market
+func krakenMatchPair(pair string, market *Market) bool {
+	if base, quote, ok := strings.Cut(pair, "/"); ok {
+		return krakenSymbol(base) == market.Base && krakenSymbol(quote) == market.Quote
+	}
+	for i := 1; i < len(pair); i++ {
+		if krakenSymbol(pair[:i]) == market.Base && krakenSymbol(pair[i:]) == market.Quote {
+			return true
+		}
+	}
+	return false
+}
+
+type kraken struct {
+	wsMarkets
+	endpoints Endpoints
+	state     sync.Mutex // guards the market fields between the stream and the refresh
+}
+
+type krakenOHLCResponse struct {
+	Error  []string                   `json:"error"`
+	Result map[string]json.RawMessage `json:"result"`
+}
+
+type krakenTicker struct {
+	Close []string `json:"c"`
+}
+
+type krakenEvent struct {
+	Event        string `json:"event"`
+	Status       string `json:"status"`
+	Pair         string `json:"pair"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+func (k *kraken) getPair(market *Market) string {
+	return krakenAsset(market.Base) + "/" + krakenAsset(market.Quote)
+}
+
+func (k *kraken) initMarket(market *Market) error {
+	var resp krakenOHLCResponse
+	url := fmt.Sprintf("%s/0/public/OHLC?pair=%s&interval=1440", k.endpoints.REST, strings.ReplaceAll(k.getPair(market), "/", ""))
+	err := httpGetJSON(url, &resp)
+	if err != nil {
+		return err
+	}
+	if len(resp.Error) > 0 {
+		return fmt.Errorf("kraken: %s", strings.Join(resp.Error, ", "))
+	}
+
+	for pair, data := range resp.Result {
+		if !krakenMatchPair(pair, market) {
+			continue
+		}
+		// [time, open, high, low, close, vwap, volume, count], oldest candle first
+		var candles [][]interface{}
+		err := json.Unmarshal(data, &candles)
+		if err != nil {
+			return err
+		}
+		if len(candles) == 0 || len(candles[len(candles)-1]) < 5 {
+			break
+		}
+		candle := candles[len(candles)-1]
+		start, _ := strconv.ParseFloat(fmt.Sprint(candle[0]), 64)
+		parsed := Candle{Start: time.Unix(int64(start), 0), Period: UTCDay}
+		parsed.Open, _ = strconv.ParseFloat(fmt.Sprint(candle[1]), 64)
+		parsed.High, _ = strconv.ParseFloat(fmt.Sprint(candle[2]), 64)
+		parsed.Low, _ = strconv.ParseFloat(fmt.Sprint(candle[3]), 64)
+		parsed.Close, _ = strconv.ParseFloat(fmt.Sprint(candle[4]), 64)
+		if len(candle) >= 7 {
+			// kraken serves the base volume and the volume weighted average price
+			vwap, _ := strconv.ParseFloat(fmt.Sprint(candle[5]), 64)
+			parsed.Volume, _ = strconv.ParseFloat(fmt.Sprint(candle[6]), 64)
+			parsed.QuoteVolume = vwap * parsed.Volume
+		}
+
+		k.state.Lock()
+		defer k.state.Unlock()
+		market.Candle = parsed
+		market.LastUpdate = time.Now()
+		return nil
+	}
+	return fmt.Errorf("no daily candle for %s", k.getPair(market))
+}
+
+// Register accepts both symbols (btc-eur) and Kraken asset codes (xbt-eur)
+func (k *kraken) Register(base string, quote string) error {
+	k.markets = append(k.markets, newMarket("kraken", krakenSymbol(base), krakenSymbol(quote)))
+	return nil
+}
+
+// NormalizePair returns the symbols of a market registered with Kraken asset codes, e.g. btc-eur for xbt-eur
+func (k *kraken) NormalizePair(base string, quote string) (string, string) {
+	return krakenSymbol(base), krakenSymbol(quote)
+}
+
+func (k *kraken) Subscribe(base string, quote string) error {
+	market := newMarket("kraken", krakenSymbol(base), krakenSymbol(quote))
+	err := k.initMarket(market)
+	if err != nil {
+		return err
+	}
+	return k.add(market, k.subscribeMessage("subscribe"))
+}
+
+func (k *kraken) Unsubscribe(base string, quote string) error {
+	return k.remove(krakenSymbol(base), krakenSymbol(quote), k.subscribeMessage("unsubscribe"))
+}
+
+func (k *kraken) subscribeMessage(event string) func(markets []*Market) interface{} {
+	return func(markets []*Market) interface{} {
+		pairs := make([]string, 0, len(markets))
+		for _, market := range markets {
+			pairs = append(pairs, k.getPair(market))
+		}
+		return map[string]interface{}{
+			"event":        event,
+			"pair":         pairs,
+			"subscription": map[string]string{"name": "ticker"},
+		}
+	}
+}
+
+func (k *kraken) handleTicker(ctx context.Context, msg []byte, update chan<- Market) error {
+	// [channelID, ticker, "ticker", pair]
+	var data []json.RawMessage
+	err := json.Unmarshal(msg, &data)
+	if err != nil || len(data) < 4 {
+		return err
+	}
+	var pair string
+	var ticker krakenTicker
+	if json.Unmarshal(data[len(data)-1], &pair) != nil || json.Unmarshal(data[1], &ticker) != nil {
+		return nil
+	}
+	if len(ticker.Close) == 0 {
+		return nil
+	}
+
+	for _, market := range k.list() {
+		if krakenMatchPair(pair, market) {
+			price, err := strconv.ParseFloat(ticker.Close[0], 64)
+			if err != nil {
+				logrus.WithError(err).WithField("market", pair).Error("cannot parse price")
+				continue
+			}
+			k.state.Lock()
+			market.Candle.UpdateAt(time.Now(), price)
+			market.LastUpdate = time.Now()
+			m := market.Snapshot()
+			k.state.Unlock()
+			send(ctx, update, m)
+		}
+	}
+	return nil
+}
+
+// Ping checks that the rest api is reachable
+func (k *kraken) Ping(ctx context.Context) error {
+	return httpPing(ctx, fmt.Sprintf("%s/0/public/Time", k.endpoints.REST))
+}
+
+func (k *kraken) Start(ctx context.Context, update chan<- Market) error {
+	for _, market := range k.list() {
+		err := k.initMarket(market)
+		if err != nil {
+			return err
+		}
+		k.state.Lock()
+		m := market.Snapshot()
+		k.state.Unlock()
+		if !send(ctx, update, m) {
+			return ctx.Err()
+		}
+	}
+	runEvery(ctx, time.Hour, func() {
+		if !sleep(ctx, time.Second*10) {
+			return
+		}
+		for _, market := range k.list() {
+			k.initMarket(market)
+		}
+	})
+
+	conn, err := dialWebsocket(ctx, k.endpoints.Websocket)
+	if err != nil {
+		return err
+	}
+	defer k.disconnect()
+
+	err = k.connect(ctx, conn, update, k.subscribeMessage("subscribe"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return conn.Serve(ctx, func(msg []byte) error {
+		if len(msg) > 0 && msg[0] == '[' {
+			return k.handleTicker(ctx, msg, update)
+		}
+
+		var event krakenEvent
+		err := json.Unmarshal(msg, &event)
+		if err != nil {
+			return err
+		}
+		if event.Event == "subscriptionStatus" && event.Status == "error" {
+			return fmt.Errorf("kraken: %s %s", event.Pair, event.ErrorMessage)
+		}
+		return nil
+	})
+}
+
+// NewKraken returns a Kraken exchange. Empty endpoints use the public Kraken api.
+func NewKraken(endpoints Endpoints) Exchange {
+	return &kraken{
+		endpoints: endpoints.withDefaults(krakenRESTURL, krakenWebsocketURL),
+	}
+}
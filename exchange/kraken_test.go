@@ -0,0 +1,36 @@
+package exchange
+
+import "testing"
+
+func TestKrakenMatchPair(t *testing.T) {
+	tests := []struct {
+		name  string
+		pair  string
+		base  string
+		quote string
+		want  bool
+	}{
+		{name: "websocket pair", pair: "XBT/EUR", base: "btc", quote: "eur", want: true},
+		{name: "rest pair", pair: "XBTEUR", base: "btc", quote: "eur", want: true},
+		{name: "legacy rest pair", pair: "XXBTZEUR", base: "btc", quote: "eur", want: true},
+		{name: "legacy quote of another market", pair: "XXBTZUSD", base: "btc", quote: "eur"},
+		{name: "websocket quote of another market", pair: "XBT/USD", base: "btc", quote: "eur"},
+		{name: "base of another market", pair: "XBTEUR", base: "eth", quote: "eur"},
+		{name: "doge alias", pair: "XDG/USD", base: "doge", quote: "usd", want: true},
+		{name: "legacy doge alias", pair: "XXDGZUSD", base: "doge", quote: "usd", want: true},
+		{name: "legacy base", pair: "XETHZEUR", base: "eth", quote: "eur", want: true},
+		{name: "bitcoin quote", pair: "ETH/XBT", base: "eth", quote: "btc", want: true},
+		{name: "legacy bitcoin quote", pair: "XETHXXBT", base: "eth", quote: "btc", want: true},
+		{name: "pair without aliases", pair: "SOLUSD", base: "sol", quote: "usd", want: true},
+		{name: "legacy quote after a plain base", pair: "USDTZUSD", base: "usdt", quote: "usd", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			market := newMarket("kraken", test.base, test.quote)
+			if got := krakenMatchPair(test.pair, market); got != test.want {
+				t.Errorf("krakenMatchPair(%q, %s) = %v, want %v", test.pair, market.Key(), got, test.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,24 @@ type Candle struct {
 	High  float64
 	Low   float64
 	Close float64
+	// Volume is the traded amount of the base currency, QuoteVolume of the quote currency. Zero when the exchange does not serve it.
+	Volume      float64
+	QuoteVolume float64
+	// Start and Period are the boundaries of the candle. A rolling Period is maintained by the exchange, e.g. a 24h ticker.
+	Start  time.Time
+	Period Period
+}
+
+// NewCandle starts the candle of the period containing t with price as its open
+func NewCandle(t time.Time, period Period, price float64) Candle {
+	return Candle{
+		Open:   price,
+		High:   price,
+		Low:    price,
+		Close:  price,
+		Start:  period.Start(t),
+		Period: period,
+	}
 }
 
 func (m *Candle) Update(close float64) {
@@ -21,6 +39,48 @@ func (m *Candle) Update(close float64) {
 	}
 }
 
+// End returns the end of the candle period
+func (m Candle) End() time.Time {
+	return m.Period.End(m.Start)
+}
+
+// isAfter reports whether t belongs to a later period than the candle
+func (m Candle) isAfter(t time.Time) bool {
+	return m.Period.bounded() && !m.Start.IsZero() && !t.Before(m.End())
+}
+
+// rollover starts the period containing t
+func (m *Candle) rollover(t time.Time, open float64) {
+	*m = NewCandle(t, m.Period, open)
+}
+
+// UpdateAt updates the candle with a price seen at time t.
+// A price after the candle period starts a new candle with the price as its open.
+func (m *Candle) UpdateAt(t time.Time, price float64) {
+	if m.isAfter(t) {
+		m.rollover(t, price)
+		return
+	}
+	m.Update(price)
+}
+
+// Merge updates the candle with a shorter candle of its period, e.g. a 5m kline of a daily candle.
+// The volumes of the kline are added. A kline starting after the candle period starts a new candle from the kline.
+func (m *Candle) Merge(kline Candle) {
+	if m.isAfter(kline.Start) {
+		m.rollover(kline.Start, kline.Open)
+	}
+	m.Close = kline.Close
+	m.Volume += kline.Volume
+	m.QuoteVolume += kline.QuoteVolume
+	if kline.High > m.High {
+		m.High = kline.High
+	}
+	if kline.Low < m.Low || m.Low == 0 {
+		m.Low = kline.Low
+	}
+}
+
 func (m Candle) Percent() float64 {
 	if m.Open == 0 {
 		return 0
@@ -35,7 +95,47 @@ func (m Candle) ToSatoshi() Candle {
 		Open:  m.Open * TO_SATOSHI,
 		Close: m.Close * TO_SATOSHI,
 		Low:   m.Low * TO_SATOSHI,
+		// the quote volume is an amount of btc
+		Volume:      m.Volume,
+		QuoteVolume: m.QuoteVolume * TO_SATOSHI,
+		Start:       m.Start,
+		Period:      m.Period,
+	}
+}
+
+// Futures contains the perpetual contract data of a futures market
+type Futures struct {
+	MarkPrice       float64
+	IndexPrice      float64
+	FundingRate     float64
+	NextFundingTime time.Time
+}
+
+// FundingRatePercent returns the current funding rate in percent
+func (f Futures) FundingRatePercent() float64 {
+	return f.FundingRate * 100
+}
+
+// BookTicker is the best bid and ask of a market
+type BookTicker struct {
+	Bid    float64
+	BidQty float64
+	Ask    float64
+	AskQty float64
+}
+
+// Spread returns the difference of the best ask and bid
+func (b BookTicker) Spread() float64 {
+	return b.Ask - b.Bid
+}
+
+// SpreadBps returns the spread in basis points of the mid price, e.g. 1.5 for 0.015%
+func (b BookTicker) SpreadBps() float64 {
+	mid := (b.Ask + b.Bid) / 2
+	if mid == 0 {
+		return 0
 	}
+	return b.Spread() / mid * 10_000
 }
 
 type Market struct {
@@ -43,7 +143,91 @@ type Market struct {
 	Base       string
 	Quote      string
 	Candle     Candle
+	Futures    Futures     // only set by futures exchanges
+	Timeframes []Timeframe // changes over rolling windows, only set by exchanges serving klines
+	Book       BookTicker  // only set for markets streaming the book ticker
 	LastUpdate time.Time
+	Replayed   bool `json:"-"` // sent by the replay exchange, LastUpdate is the time of the replay
+
+	streamed Candle // last state of the open kline of a kline stream, zero after the candle was fetched
+	// volume traded since the last snapshot, only counted by the streams sending the volume of every trade or kline
+	tradedVolume      float64
+	tradedQuoteVolume float64
+}
+
+// IsFutures reports whether the market has futures data
+func (m Market) IsFutures() bool {
+	return m.Futures.MarkPrice != 0
+}
+
+// HasBook reports whether the market has a best bid and ask
+func (m Market) HasBook() bool {
+	return m.Book.Bid != 0 && m.Book.Ask != 0
+}
+
+// Timeframe returns the timeframe by name, e.g. {{(.Timeframe "7d").Percent}} in templates
+func (m Market) Timeframe(name string) Timeframe {
+	for _, timeframe := range m.Timeframes {
+		if timeframe.Name == name {
+			return timeframe
+		}
+	}
+	return Timeframe{Name: name}
+}
+
+// Snapshot returns a copy of the market which shares no memory with m,
+// so the exchange can keep updating m while the copy is displayed.
+// The volume traded since the last snapshot is handed to the copy, it is counted once by the aggregator.
+func (m *Market) Snapshot() Market {
+	snapshot := *m
+	snapshot.Timeframes = append([]Timeframe(nil), m.Timeframes...)
+	m.tradedVolume, m.tradedQuoteVolume = 0, 0
+	return snapshot
+}
+
+// addTraded counts the volume traded since the last snapshot
+func (m *Market) addTraded(volume, quoteVolume float64) {
+	m.tradedVolume += volume
+	m.tradedQuoteVolume += quoteVolume
+}
+
+// timeframeNames returns the names of the tracked timeframes
+func (m *Market) timeframeNames() []string {
+	names := make([]string, 0, len(m.Timeframes))
+	for _, timeframe := range m.Timeframes {
+		names = append(names, timeframe.Name)
+	}
+	return names
+}
+
+// updateTimeframes updates the timeframes with a live price
+func (m *Market) updateTimeframes(price float64) {
+	for i := range m.Timeframes {
+		if m.Timeframes[i].Open != 0 {
+			m.Timeframes[i].Update(price)
+		}
+	}
+}
+
+// mergeKline merges a kline of a stream into the candle. The stream repeats the open kline with its volume so far,
+// so only the volume traded since the last state of the kline is added.
+// The volume of a rolling candle is only set by the refetch, the stream cannot drop the volume leaving the window.
+func (m *Market) mergeKline(kline Candle) {
+	last := m.streamed
+	m.streamed = kline
+	switch {
+	case last.Start.IsZero():
+		// the fetched candle already counts the open kline, the volume since the fetch is unknown
+		kline.Volume, kline.QuoteVolume = 0, 0
+	case last.Start.Equal(kline.Start):
+		kline.Volume -= last.Volume
+		kline.QuoteVolume -= last.QuoteVolume
+	}
+	m.addTraded(kline.Volume, kline.QuoteVolume)
+	if m.Candle.Period.Rolling() {
+		kline.Volume, kline.QuoteVolume = 0, 0
+	}
+	m.Candle.Merge(kline)
 }
 
 func (m *Market) Key() string {
@@ -51,16 +235,19 @@ func (m *Market) Key() string {
 }
 
 type MarketDisplayInfo struct {
-	Market Market
+	Market                      Market
 	LastConfirmedConnectionTime time.Time
+	Connection                  ConnectionEvent // last connection event of the exchange of the market
+	History                     []PricePoint    `json:"-"` // close price of every minute of the last day, oldest first. Only set for a HistoryObserver.
+	Candles                     []Candle        `json:"-"` // current candles of the DefaultBuilderPeriods built from the updates
 }
 
 func newMarket(name, base, quote string) *Market {
 	return &Market{
-		Exchange: name,
-		Base:     base,
-		Quote:    quote,
-		Candle:   Candle{},
+		Exchange:   name,
+		Base:       base,
+		Quote:      quote,
+		Candle:     Candle{},
 		LastUpdate: time.Time{},
 	}
 }
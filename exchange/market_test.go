@@ -0,0 +1,168 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+// sameCandle reports whether the candles have the same prices, volumes and start
+func sameCandle(a, b Candle) bool {
+	return a.Open == b.Open && a.High == b.High && a.Low == b.Low && a.Close == b.Close &&
+		a.Volume == b.Volume && a.QuoteVolume == b.QuoteVolume && a.Start.Equal(b.Start)
+}
+
+func TestCandleUpdateAt(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	candle := func(period Period, open, high, low, close float64, start time.Time) Candle {
+		return Candle{Open: open, High: high, Low: low, Close: close, Start: start, Period: period}
+	}
+
+	tests := []struct {
+		name   string
+		candle Candle
+		t      time.Time
+		price  float64
+		want   Candle
+	}{
+		{
+			name:   "new high",
+			candle: candle(UTCDay, 100, 110, 90, 105, day),
+			t:      day.Add(12 * time.Hour),
+			price:  120,
+			want:   candle(UTCDay, 100, 120, 90, 120, day),
+		},
+		{
+			name:   "new low at the last instant",
+			candle: candle(UTCDay, 100, 110, 90, 105, day),
+			t:      day.Add(24*time.Hour - time.Nanosecond),
+			price:  80,
+			want:   candle(UTCDay, 100, 110, 80, 80, day),
+		},
+		{
+			name:   "rollover at the end",
+			candle: candle(UTCDay, 100, 110, 90, 105, day),
+			t:      day.Add(24 * time.Hour),
+			price:  107,
+			want:   candle(UTCDay, 107, 107, 107, 107, day.Add(24*time.Hour)),
+		},
+		{
+			name:   "rollover over missed periods",
+			candle: candle(UTCDay, 100, 110, 90, 105, day),
+			t:      day.Add(3*24*time.Hour + time.Hour),
+			price:  95,
+			want:   candle(UTCDay, 95, 95, 95, 95, day.Add(3*24*time.Hour)),
+		},
+		{
+			name:   "rollover of the minute",
+			candle: candle(UTCMinute, 100, 100, 100, 100, day),
+			t:      day.Add(90 * time.Second),
+			price:  101,
+			want:   candle(UTCMinute, 101, 101, 101, 101, day.Add(time.Minute)),
+		},
+		{
+			name:   "rolling period never rolls over",
+			candle: candle(Rolling24h, 100, 110, 90, 105, day),
+			t:      day.Add(48 * time.Hour),
+			price:  108,
+			want:   candle(Rolling24h, 100, 110, 90, 108, day),
+		},
+		{
+			name:   "unknown period never rolls over",
+			candle: candle(Period{}, 100, 110, 90, 105, day),
+			t:      day.Add(48 * time.Hour),
+			price:  108,
+			want:   candle(Period{}, 100, 110, 90, 108, day),
+		},
+		{
+			name:   "candle without start",
+			candle: candle(UTCDay, 100, 110, 90, 105, time.Time{}),
+			t:      day,
+			price:  108,
+			want:   candle(UTCDay, 100, 110, 90, 108, time.Time{}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candle := test.candle
+			candle.UpdateAt(test.t, test.price)
+			if !sameCandle(candle, test.want) {
+				t.Errorf("UpdateAt() = %+v, want %+v", candle, test.want)
+			}
+		})
+	}
+}
+
+func TestMarketMergeKline(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	kline := func(start time.Time, open, close, volume float64) Candle {
+		return Candle{Open: open, High: max(open, close), Low: min(open, close), Close: close, Volume: volume, QuoteVolume: volume * close, Start: start}
+	}
+	noon := day.Add(12 * time.Hour)
+	lastKline := day.Add(24*time.Hour - 5*time.Minute)
+
+	tests := []struct {
+		name       string
+		period     Period
+		streamed   Candle // last kline of the stream, zero after a fetch
+		kline      Candle
+		want       Candle
+		wantTraded float64 // base volume counted since the last snapshot
+	}{
+		{
+			name:       "first kline after the fetch",
+			period:     UTCDay,
+			kline:      kline(noon, 104, 106, 2),
+			want:       Candle{Open: 100, High: 110, Low: 90, Close: 106, Volume: 10, QuoteVolume: 1000, Start: day},
+			wantTraded: 0,
+		},
+		{
+			name:       "open kline repeated",
+			period:     UTCDay,
+			streamed:   kline(noon, 104, 106, 2),
+			kline:      kline(noon, 104, 106, 5),
+			want:       Candle{Open: 100, High: 110, Low: 90, Close: 106, Volume: 13, QuoteVolume: 1318, Start: day},
+			wantTraded: 3,
+		},
+		{
+			name:       "next kline",
+			period:     UTCDay,
+			streamed:   kline(noon, 104, 106, 5),
+			kline:      kline(noon.Add(5*time.Minute), 106, 112, 1),
+			want:       Candle{Open: 100, High: 112, Low: 90, Close: 112, Volume: 11, QuoteVolume: 1112, Start: day},
+			wantTraded: 1,
+		},
+		{
+			name:       "kline of the next day rolls over",
+			period:     UTCDay,
+			streamed:   kline(lastKline, 104, 105, 5),
+			kline:      kline(day.Add(24*time.Hour), 105, 107, 2),
+			want:       Candle{Open: 105, High: 107, Low: 105, Close: 107, Volume: 2, QuoteVolume: 214, Start: day.Add(24 * time.Hour)},
+			wantTraded: 2,
+		},
+		{
+			name:       "rolling candle keeps the fetched volume",
+			period:     Rolling24h,
+			streamed:   kline(noon, 104, 106, 2),
+			kline:      kline(noon, 104, 106, 5),
+			want:       Candle{Open: 100, High: 110, Low: 90, Close: 106, Volume: 10, QuoteVolume: 1000, Start: day},
+			wantTraded: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			market := newMarket("binance", "btc", "usdt")
+			market.Candle = Candle{Open: 100, High: 110, Low: 90, Close: 105, Volume: 10, QuoteVolume: 1000, Start: day, Period: test.period}
+			market.streamed = test.streamed
+			market.mergeKline(test.kline)
+
+			if !sameCandle(market.Candle, test.want) {
+				t.Errorf("candle = %+v, want %+v", market.Candle, test.want)
+			}
+			if snapshot := market.Snapshot(); snapshot.tradedVolume != test.wantTraded {
+				t.Errorf("traded volume = %v, want %v", snapshot.tradedVolume, test.wantTraded)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	okxRESTURL      = "https://www.okx.com"
+	okxWebsocketURL = "wss://ws.okx.com:8443/ws/v5/public"
+)
+
+type okx struct {
+	wsMarkets
+	endpoints Endpoints
+	state     sync.Mutex // guards the market fields between the stream and the refresh
+}
+
+type okxCandlesResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	// [ts, open, high, low, close, vol, volCcy, volCcyQuote, confirm], newest candle first
+	Data [][]string `json:"data"`
+}
+
+type okxMessage struct {
+	Event string `json:"event"`
+	Msg   string `json:"msg"`
+	Arg   struct {
+		Channel string `json:"channel"`
+	} `json:"arg"`
+	Data []struct {
+		InstID string `json:"instId"`
+		Last   string `json:"last"`
+	} `json:"data"`
+}
+
+func (o *okx) getInstID(market *Market) string {
+	return strings.ToUpper(market.Base + "-" + market.Quote)
+}
+
+func (o *okx) initMarket(market *Market) error {
+	var resp okxCandlesResponse
+	url := fmt.Sprintf("%s/api/v5/market/candles?instId=%s&bar=1Dutc&limit=1", o.endpoints.REST, o.getInstID(market))
+	err := httpGetJSON(url, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Code != "0" {
+		return fmt.Errorf("okx: %s", resp.Msg)
+	}
+	if len(resp.Data) == 0 || len(resp.Data[0]) < 5 {
+		return fmt.Errorf("no daily candle for %s", o.getInstID(market))
+	}
+	candle := resp.Data[0]
+	start, _ := strconv.ParseInt(candle[0], 10, 64)
+	parsed := Candle{Start: time.UnixMilli(start), Period: UTCDay}
+	parsed.Open, _ = strconv.ParseFloat(candle[1], 64)
+	parsed.High, _ = strconv.ParseFloat(candle[2], 64)
+	parsed.Low, _ = strconv.ParseFloat(candle[3], 64)
+	parsed.Close, _ = strconv.ParseFloat(candle[4], 64)
+	if len(candle) >= 8 {
+		parseVolume(&parsed, candle[5], candle[7])
+	}
+
+	o.state.Lock()
+	defer o.state.Unlock()
+	market.Candle = parsed
+	market.LastUpdate = time.Now()
+	return nil
+}
+
+func (o *okx) Register(base string, quote string) error {
+	o.markets = append(o.markets, newMarket("okx", base, quote))
+	return nil
+}
+
+func (o *okx) Subscribe(base string, quote string) error {
+	market := newMarket("okx", base, quote)
+	err := o.initMarket(market)
+	if err != nil {
+		return err
+	}
+	return o.add(market, o.subscribeMessage("subscribe"))
+}
+
+func (o *okx) Unsubscribe(base string, quote string) error {
+	return o.remove(base, quote, o.subscribeMessage("unsubscribe"))
+}
+
+func (o *okx) subscribeMessage(op string) func(markets []*Market) interface{} {
+	return func(markets []*Market) interface{} {
+		args := make([]map[string]string, 0, len(markets))
+		for _, market := range markets {
+			args = append(args, map[string]string{"channel": "tickers", "instId": o.getInstID(market)})
+		}
+		return map[string]interface{}{
+			"op":   op,
+			"args": args,
+		}
+	}
+}
+
+// Ping checks that the rest api is reachable
+func (o *okx) Ping(ctx context.Context) error {
+	return httpPing(ctx, fmt.Sprintf("%s/api/v5/public/time", o.endpoints.REST))
+}
+
+func (o *okx) Start(ctx context.Context, update chan<- Market) error {
+	for _, market := range o.list() {
+		err := o.initMarket(market)
+		if err != nil {
+			return err
+		}
+		o.state.Lock()
+		m := market.Snapshot()
+		o.state.Unlock()
+		if !send(ctx, update, m) {
+			return ctx.Err()
+		}
+	}
+	runEvery(ctx, time.Hour, func() {
+		if !sleep(ctx, time.Second*10) {
+			return
+		}
+		for _, market := range o.list() {
+			o.initMarket(market)
+		}
+	})
+
+	conn, err := dialWebsocket(ctx, o.endpoints.Websocket)
+	if err != nil {
+		return err
+	}
+	defer o.disconnect()
+
+	err = o.connect(ctx, conn, update, o.subscribeMessage("subscribe"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	// okx drops the connection when nothing is sent in 30 seconds
+	conn.KeepAlive(ctx, time.Second*20, func() error {
+		return conn.WriteText("ping")
+	})
+
+	return conn.Serve(ctx, func(msg []byte) error {
+		if string(msg) == "pong" {
+			return nil
+		}
+
+		var event okxMessage
+		err := json.Unmarshal(msg, &event)
+		if err != nil {
+			return err
+		}
+		if event.Event == "error" {
+			return fmt.Errorf("okx: %s", event.Msg)
+		}
+		if event.Arg.Channel != "tickers" {
+			return nil
+		}
+
+		for _, data := range event.Data {
+			for _, market := range o.list() {
+				if strings.EqualFold(o.getInstID(market), data.InstID) {
+					price, err := strconv.ParseFloat(data.Last, 64)
+					if err != nil {
+						logrus.WithError(err).WithField("market", data.InstID).Error("cannot parse price")
+						continue
+					}
+					o.state.Lock()
+					market.Candle.UpdateAt(time.Now(), price)
+					market.LastUpdate = time.Now()
+					m := market.Snapshot()
+					o.state.Unlock()
+					send(ctx, update, m)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// NewOKX returns an OKX spot exchange. Empty endpoints use the public OKX api.
+func NewOKX(endpoints Endpoints) Exchange {
+	return &okx{
+		endpoints: endpoints.withDefaults(okxRESTURL, okxWebsocketURL),
+	}
+}
@@ -0,0 +1,174 @@
+package exchange
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DepthBandPercents are the distances from the mid price of the cumulative depth, ±1% and ±2%
+var DepthBandPercents = []float64{1, 2}
+
+// OrderBookLevel is a price level of an order book
+type OrderBookLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+// DepthBand is the cumulative depth of the order book within Percent of the mid price.
+// Notional is the value in the quote currency, the sum of price * quantity.
+// Partial is set when the known levels of a side end before the edge of the band, the depth is a lower bound then.
+type DepthBand struct {
+	Percent     float64
+	BidQuantity float64
+	BidNotional float64
+	AskQuantity float64
+	AskNotional float64
+	Partial     bool
+}
+
+// OrderBookDepth is the top of an order book and its cumulative depth around the mid price
+type OrderBookDepth struct {
+	Mid      float64
+	Bids     []OrderBookLevel // best bid first
+	Asks     []OrderBookLevel // best ask first
+	Bands    []DepthBand      // one per DepthBandPercents
+	UpdateID int64            // last update applied to the book
+	Time     time.Time        // time of the last update
+}
+
+// orderBook is a local copy of an order book kept in sync by an exchange. It is safe for concurrent use.
+type orderBook struct {
+	mu       sync.Mutex
+	bids     map[float64]float64 // price - quantity
+	asks     map[float64]float64 // price - quantity
+	updateID int64
+	time     time.Time
+	synced   bool // false until the first snapshot and after a lost update
+}
+
+// reset replaces the book with a snapshot
+func (o *orderBook) reset(updateID int64, bids, asks []OrderBookLevel) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.bids = make(map[float64]float64, len(bids))
+	o.asks = make(map[float64]float64, len(asks))
+	setLevels(o.bids, bids)
+	setLevels(o.asks, asks)
+	o.updateID = updateID
+	o.time = time.Now()
+	o.synced = true
+}
+
+// update applies a diff to the book. A level with zero quantity is removed.
+func (o *orderBook) update(updateID int64, bids, asks []OrderBookLevel) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	setLevels(o.bids, bids)
+	setLevels(o.asks, asks)
+	o.updateID = updateID
+	o.time = time.Now()
+}
+
+func setLevels(side map[float64]float64, levels []OrderBookLevel) {
+	for _, level := range levels {
+		if level.Quantity == 0 {
+			delete(side, level.Price)
+		} else {
+			side[level.Price] = level.Quantity
+		}
+	}
+}
+
+// invalidate marks the book out of sync until the next snapshot
+func (o *orderBook) invalidate() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.synced = false
+}
+
+// lastUpdateID returns the id of the last snapshot or diff applied to the book
+func (o *orderBook) lastUpdateID() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.updateID
+}
+
+// depth returns the best levels of both sides, at most levels each, and the cumulative depth bands
+func (o *orderBook) depth(levels int) (OrderBookDepth, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.synced {
+		return OrderBookDepth{}, fmt.Errorf("order book is not synced")
+	}
+
+	bids := sortedLevels(o.bids, func(a, b float64) bool { return a > b })
+	asks := sortedLevels(o.asks, func(a, b float64) bool { return a < b })
+	depth := OrderBookDepth{
+		UpdateID: o.updateID,
+		Time:     o.time,
+	}
+	if len(bids) > 0 && len(asks) > 0 {
+		depth.Mid = (bids[0].Price + asks[0].Price) / 2
+	}
+
+	for _, percent := range DepthBandPercents {
+		band := DepthBand{Percent: percent}
+		low, high := depth.Mid*(1-percent/100), depth.Mid*(1+percent/100)
+		for _, bid := range bids {
+			if bid.Price < low {
+				break
+			}
+			band.BidQuantity += bid.Quantity
+			band.BidNotional += bid.Price * bid.Quantity
+		}
+		for _, ask := range asks {
+			if ask.Price > high {
+				break
+			}
+			band.AskQuantity += ask.Quantity
+			band.AskNotional += ask.Price * ask.Quantity
+		}
+		// the farthest known level of a side must reach the edge of the band
+		band.Partial = len(bids) == 0 || len(asks) == 0 || bids[len(bids)-1].Price > low || asks[len(asks)-1].Price < high
+		depth.Bands = append(depth.Bands, band)
+	}
+
+	levels = max(levels, 0)
+	depth.Bids = bids[:min(levels, len(bids))]
+	depth.Asks = asks[:min(levels, len(asks))]
+	return depth, nil
+}
+
+// sortedLevels returns the levels of a side ordered by price
+func sortedLevels(side map[float64]float64, less func(a, b float64) bool) []OrderBookLevel {
+	levels := make([]OrderBookLevel, 0, len(side))
+	for price, quantity := range side {
+		levels = append(levels, OrderBookLevel{Price: price, Quantity: quantity})
+	}
+	sort.Slice(levels, func(i, j int) bool { return less(levels[i].Price, levels[j].Price) })
+	return levels
+}
+
+// ToSatoshi returns the depth with the prices and notionals in satoshi
+func (d OrderBookDepth) ToSatoshi() OrderBookDepth {
+	const TO_SATOSHI = 100_000_000
+	converted := d
+	converted.Mid *= TO_SATOSHI
+	converted.Bids = make([]OrderBookLevel, len(d.Bids))
+	for i, level := range d.Bids {
+		converted.Bids[i] = OrderBookLevel{Price: level.Price * TO_SATOSHI, Quantity: level.Quantity}
+	}
+	converted.Asks = make([]OrderBookLevel, len(d.Asks))
+	for i, level := range d.Asks {
+		converted.Asks[i] = OrderBookLevel{Price: level.Price * TO_SATOSHI, Quantity: level.Quantity}
+	}
+	converted.Bands = make([]DepthBand, len(d.Bands))
+	for i, band := range d.Bands {
+		band.BidNotional *= TO_SATOSHI
+		band.AskNotional *= TO_SATOSHI
+		converted.Bands[i] = band
+	}
+	return converted
+}
@@ -0,0 +1,164 @@
+package exchange
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Period is the reference period of a candle, the percent change is relative to its open
+// The zero Period is unknown, every exchange sets one, e.g. UTCDay for the candles built from http and exec prices.
+type Period struct {
+	Name     string         // 24h (rolling window), 1m, 5m, 1h, 4h, day, week or month
+	Location *time.Location // timezone of the period boundaries, UTC when nil
+}
+
+var (
+	// UTCMinute is the minute
+	UTCMinute = Period{Name: "1m", Location: time.UTC}
+	// UTCFiveMinutes is the five minutes starting at a multiple of five
+	UTCFiveMinutes = Period{Name: "5m", Location: time.UTC}
+	// UTCHour is the full hour in UTC
+	UTCHour = Period{Name: "1h", Location: time.UTC}
+	// UTCDay is the default period, the calendar day in UTC
+	UTCDay = Period{Name: "day", Location: time.UTC}
+	// Rolling24h is the last 24 hours
+	Rolling24h = Period{Name: "24h"}
+)
+
+// periodCandle aggregates the klines of the period containing now into one candle.
+// fetch returns the klines of the interval from start, oldest first.
+func periodCandle(period Period, now time.Time, fetch func(interval string, start time.Time) ([]Candle, error)) (Candle, error) {
+	start := period.Start(now)
+	// timezones with half hour offsets need shorter klines
+	interval, step := "1h", time.Hour
+	if start.Unix()%3600 != 0 {
+		interval, step = "15m", 15*time.Minute
+	}
+
+	candle := Candle{Start: start, Period: period}
+	for from := start; from.Before(now); {
+		klines, err := fetch(interval, from)
+		if err != nil {
+			return Candle{}, err
+		}
+		if len(klines) == 0 {
+			break
+		}
+		for _, kline := range klines {
+			if candle.Open == 0 {
+				candle.Open = kline.Open
+			}
+			candle.Merge(kline)
+		}
+		from = klines[len(klines)-1].Start.Add(step)
+	}
+	if candle.Open == 0 {
+		return Candle{}, fmt.Errorf("no klines since %s", start)
+	}
+	return candle, nil
+}
+
+// ParsePeriod parses the period and tz market options, e.g. period=day&tz=Europe/Berlin.
+// The default is the calendar day in UTC, tz=local is the timezone of the machine.
+func ParsePeriod(options url.Values) (Period, error) {
+	period := UTCDay
+	if v := options.Get("period"); v != "" {
+		switch v {
+		case "24h", "1h", "4h", "day", "week", "month":
+			period.Name = v
+		default:
+			return Period{}, fmt.Errorf("unknown period %q", v)
+		}
+	}
+
+	if v := options.Get("tz"); v != "" {
+		if period.Rolling() {
+			return Period{}, fmt.Errorf("the rolling 24h period has no timezone")
+		}
+		period.Location = time.Local
+		if v != "local" {
+			location, err := time.LoadLocation(v)
+			if err != nil {
+				return Period{}, fmt.Errorf("invalid timezone: %w", err)
+			}
+			period.Location = location
+		}
+	}
+	if period.Rolling() {
+		period.Location = nil
+	}
+	return period, nil
+}
+
+// Rolling reports whether the period is a sliding window without boundaries
+func (p Period) Rolling() bool {
+	return p.Name == "24h"
+}
+
+// bounded reports whether the period has boundaries to roll the candle over
+func (p Period) bounded() bool {
+	return p.Name != "" && !p.Rolling()
+}
+
+func (p Period) location() *time.Location {
+	if p.Location == nil {
+		return time.UTC
+	}
+	return p.Location
+}
+
+// Start returns the start of the period containing t
+func (p Period) Start(t time.Time) time.Time {
+	t = t.In(p.location())
+	year, month, day := t.Date()
+	switch p.Name {
+	case "1m":
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case "5m":
+		return time.Date(year, month, day, t.Hour(), t.Minute()/5*5, 0, 0, t.Location())
+	case "1h":
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case "4h":
+		return time.Date(year, month, day, t.Hour()/4*4, 0, 0, 0, t.Location())
+	case "day":
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case "week":
+		// weeks start on monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+	return t.Add(-24 * time.Hour)
+}
+
+// End returns the end of the period starting at start
+func (p Period) End(start time.Time) time.Time {
+	start = start.In(p.location())
+	year, month, day := start.Date()
+	switch p.Name {
+	case "1m":
+		return time.Date(year, month, day, start.Hour(), start.Minute()+1, 0, 0, start.Location())
+	case "5m":
+		return time.Date(year, month, day, start.Hour(), start.Minute()+5, 0, 0, start.Location())
+	case "1h":
+		return time.Date(year, month, day, start.Hour()+1, 0, 0, 0, start.Location())
+	case "4h":
+		return time.Date(year, month, day, start.Hour()+4, 0, 0, 0, start.Location())
+	case "day":
+		return start.AddDate(0, 0, 1)
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.Add(24 * time.Hour)
+}
+
+func (p Period) String() string {
+	if !p.bounded() {
+		return p.Name
+	}
+	return p.Name + " " + p.location().String()
+}
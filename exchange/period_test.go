@@ -0,0 +1,146 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodStartEnd(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		period    Period
+		t         time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "minute",
+			period:    UTCMinute,
+			t:         time.Date(2026, 10, 18, 10, 7, 30, 0, time.UTC),
+			wantStart: utc(2026, 10, 18, 10, 7),
+			wantEnd:   utc(2026, 10, 18, 10, 8),
+		},
+		{
+			name:      "five minutes before the hour",
+			period:    UTCFiveMinutes,
+			t:         time.Date(2026, 10, 18, 10, 59, 59, 0, time.UTC),
+			wantStart: utc(2026, 10, 18, 10, 55),
+			wantEnd:   utc(2026, 10, 18, 11, 0),
+		},
+		{
+			name:      "hour with a half hour offset",
+			period:    Period{Name: "1h", Location: kolkata},
+			t:         utc(2026, 10, 18, 10, 0),
+			wantStart: utc(2026, 10, 18, 9, 30),
+			wantEnd:   utc(2026, 10, 18, 10, 30),
+		},
+		{
+			name:      "utc day",
+			period:    UTCDay,
+			t:         utc(2026, 10, 18, 23, 59),
+			wantStart: utc(2026, 10, 18, 0, 0),
+			wantEnd:   utc(2026, 10, 19, 0, 0),
+		},
+		{
+			name:      "local day after the utc day",
+			period:    Period{Name: "day", Location: berlin},
+			t:         utc(2026, 10, 18, 23, 30),
+			wantStart: utc(2026, 10, 18, 22, 0),
+			wantEnd:   utc(2026, 10, 19, 22, 0),
+		},
+		{
+			name:      "23 hour day at the dst start",
+			period:    Period{Name: "day", Location: berlin},
+			t:         utc(2026, 3, 29, 10, 0),
+			wantStart: utc(2026, 3, 28, 23, 0),
+			wantEnd:   utc(2026, 3, 29, 22, 0),
+		},
+		{
+			name:      "25 hour day at the dst end",
+			period:    Period{Name: "day", Location: berlin},
+			t:         utc(2026, 10, 25, 10, 0),
+			wantStart: utc(2026, 10, 24, 22, 0),
+			wantEnd:   utc(2026, 10, 25, 23, 0),
+		},
+		{
+			name:      "4h skipping the dst hour",
+			period:    Period{Name: "4h", Location: berlin},
+			t:         utc(2026, 3, 29, 0, 30),
+			wantStart: utc(2026, 3, 28, 23, 0),
+			wantEnd:   utc(2026, 3, 29, 2, 0),
+		},
+		{
+			name:      "4h after the dst start",
+			period:    Period{Name: "4h", Location: berlin},
+			t:         utc(2026, 3, 29, 3, 0),
+			wantStart: utc(2026, 3, 29, 2, 0),
+			wantEnd:   utc(2026, 3, 29, 6, 0),
+		},
+		{
+			name:      "week from sunday",
+			period:    Period{Name: "week", Location: time.UTC},
+			t:         utc(2026, 10, 18, 12, 0),
+			wantStart: utc(2026, 10, 12, 0, 0),
+			wantEnd:   utc(2026, 10, 19, 0, 0),
+		},
+		{
+			name:      "week across the month",
+			period:    Period{Name: "week", Location: time.UTC},
+			t:         utc(2026, 11, 1, 12, 0),
+			wantStart: utc(2026, 10, 26, 0, 0),
+			wantEnd:   utc(2026, 11, 2, 0, 0),
+		},
+		{
+			name:      "week across the dst end",
+			period:    Period{Name: "week", Location: berlin},
+			t:         utc(2026, 10, 25, 12, 0),
+			wantStart: utc(2026, 10, 18, 22, 0),
+			wantEnd:   utc(2026, 10, 25, 23, 0),
+		},
+		{
+			name:      "utc month at the end of the year",
+			period:    Period{Name: "month", Location: time.UTC},
+			t:         utc(2026, 12, 31, 23, 0),
+			wantStart: utc(2026, 12, 1, 0, 0),
+			wantEnd:   utc(2027, 1, 1, 0, 0),
+		},
+		{
+			name:      "local month of the next year",
+			period:    Period{Name: "month", Location: berlin},
+			t:         utc(2026, 12, 31, 23, 30),
+			wantStart: utc(2026, 12, 31, 23, 0),
+			wantEnd:   utc(2027, 1, 31, 23, 0),
+		},
+		{
+			name:      "rolling 24h",
+			period:    Rolling24h,
+			t:         utc(2026, 10, 18, 10, 0),
+			wantStart: utc(2026, 10, 17, 10, 0),
+			wantEnd:   utc(2026, 10, 18, 10, 0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := test.period.Start(test.t)
+			if !start.Equal(test.wantStart) {
+				t.Errorf("Start() = %s, want %s", start.UTC(), test.wantStart)
+			}
+			if end := test.period.End(start); !end.Equal(test.wantEnd) {
+				t.Errorf("End() = %s, want %s", end.UTC(), test.wantEnd)
+			}
+		})
+	}
+}
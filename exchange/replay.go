@@ -0,0 +1,114 @@
+package exchange
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// RecordedUpdate is a line of a market update recording
+type RecordedUpdate struct {
+	Time time.Time         `json:"time"`
+	Info MarketDisplayInfo `json:"info"`
+}
+
+// replay re-emits the market updates of a recording.
+// The markets keep their original exchange name so alerts and bar actions match the recorded markets.
+type replay struct {
+	path    string
+	speed   float64
+	markets []*Market // the exchange of a market is the recorded exchange name, empty until the first matching update
+}
+
+func (r *replay) Register(base string, quote string) error {
+	return r.RegisterWithOptions(base, quote, nil)
+}
+
+// RegisterWithOptions accepts the exchange option, the recorded exchange of the market, e.g. replay:btc-usdt?exchange=binance.
+// Without it the market replays the exchange of its first recorded update.
+func (r *replay) RegisterWithOptions(base string, quote string, options url.Values) error {
+	r.markets = append(r.markets, newMarket(strings.ToLower(options.Get("exchange")), base, quote))
+	return nil
+}
+
+// registered reports whether a recorded market is replayed. A recording may contain the same pair from several exchanges.
+func (r *replay) registered(market Market) bool {
+	for _, m := range r.markets {
+		if !strings.EqualFold(m.Base, market.Base) || !strings.EqualFold(m.Quote, market.Quote) {
+			continue
+		}
+		if m.Exchange == "" {
+			m.Exchange = strings.ToLower(market.Exchange)
+		}
+		if strings.EqualFold(m.Exchange, market.Exchange) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *replay) Start(ctx context.Context, update chan<- Market) error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var last time.Time
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record RecordedUpdate
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return err
+		}
+		if !r.registered(record.Info.Market) {
+			continue
+		}
+
+		if r.speed > 0 && !last.IsZero() {
+			wait := time.Duration(float64(record.Time.Sub(last)) / r.speed)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		last = record.Time
+
+		market := record.Info.Market
+		market.LastUpdate = time.Now()
+		market.Replayed = true
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case update <- market:
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// keep the last state on display instead of restarting the replay
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// StallTimeout disables the stall watchdog, recordings may have long gaps
+func (r *replay) StallTimeout() time.Duration {
+	return 0
+}
+
+// NewReplay returns an exchange replaying a recording made by the recorder observer.
+// Speed 1 replays in the original pace, 10 is ten times faster, 0 replays instantly.
+func NewReplay(path string, speed float64) Exchange {
+	return &replay{
+		path:  path,
+		speed: speed,
+	}
+}
@@ -0,0 +1,31 @@
+package exchange
+
+import (
+	"time"
+)
+
+// suspendDetector detects a suspend of the machine between two checks.
+// The monotonic clock stops while the machine is suspended but the wall clock keeps going,
+// so after a resume the elapsed wall time is longer than the elapsed monotonic time.
+type suspendDetector struct {
+	last      time.Time
+	threshold time.Duration
+}
+
+func newSuspendDetector(threshold time.Duration) *suspendDetector {
+	return &suspendDetector{
+		last:      time.Now(),
+		threshold: threshold,
+	}
+}
+
+// check returns how long the machine was suspended since the last check
+func (d *suspendDetector) check(now time.Time) (time.Duration, bool) {
+	monotonic := now.Sub(d.last)
+	// Round(0) strips the monotonic clock reading, so Sub uses the wall clock
+	wall := now.Round(0).Sub(d.last.Round(0))
+	d.last = now
+
+	suspended := wall - monotonic
+	return suspended, suspended >= d.threshold
+}
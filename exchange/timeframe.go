@@ -0,0 +1,87 @@
+package exchange
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Timeframe is the change of a market over a rolling window, e.g. the last 7 days
+type Timeframe struct {
+	Name   string
+	Window time.Duration
+	Candle
+}
+
+// timeframeDefinition is a supported timeframe and the klines it is built from
+type timeframeDefinition struct {
+	name     string
+	window   time.Duration
+	interval string
+	step     time.Duration
+}
+
+var timeframeDefinitions = []timeframeDefinition{
+	{"1h", time.Hour, "5m", 5 * time.Minute},
+	{"24h", 24 * time.Hour, "1h", time.Hour},
+	{"7d", 7 * 24 * time.Hour, "4h", 4 * time.Hour},
+	{"30d", 30 * 24 * time.Hour, "1d", 24 * time.Hour},
+}
+
+// ParseTimeframes parses the timeframes market option, e.g. timeframes=1h,7d. No timeframes are tracked without it.
+func ParseTimeframes(options url.Values) ([]string, error) {
+	v := options.Get("timeframes")
+	if v == "" {
+		return nil, nil
+	}
+
+	names := strings.Split(v, ",")
+	for _, name := range names {
+		if _, ok := findTimeframe(name); !ok {
+			return nil, fmt.Errorf("unknown timeframe %q", name)
+		}
+	}
+	return names, nil
+}
+
+func findTimeframe(name string) (timeframeDefinition, bool) {
+	for _, definition := range timeframeDefinitions {
+		if definition.name == name {
+			return definition, true
+		}
+	}
+	return timeframeDefinition{}, false
+}
+
+// fetchTimeframes builds the timeframes ending at now from klines.
+// fetch returns the klines of the interval from start, oldest first.
+func fetchTimeframes(names []string, now time.Time, fetch func(interval string, start time.Time) ([]Candle, error)) ([]Timeframe, error) {
+	timeframes := make([]Timeframe, 0, len(names))
+	for _, name := range names {
+		definition, ok := findTimeframe(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown timeframe %q", name)
+		}
+
+		// the first kline contains the start of the window
+		klines, err := fetch(definition.interval, now.Add(-definition.window).Truncate(definition.step))
+		if err != nil {
+			return nil, err
+		}
+		if len(klines) == 0 {
+			return nil, fmt.Errorf("no klines for the %s timeframe", name)
+		}
+
+		timeframe := Timeframe{
+			Name:   name,
+			Window: definition.window,
+			Candle: Candle{Start: now.Add(-definition.window), Open: klines[0].Open},
+		}
+		for _, kline := range klines {
+			timeframe.Candle.Merge(kline)
+		}
+		timeframes = append(timeframes, timeframe)
+	}
+	return timeframes, nil
+}
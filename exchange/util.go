@@ -3,21 +3,55 @@ package exchange
 import (
 	"context"
 	"encoding/json"
-	"math/rand"
-	"net"
+	"fmt"
 	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var httpClient = http.Client{Timeout: 5 * time.Second}
 
+// httpPing checks that the url answers with 200 OK
+func httpPing(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
 func httpGetJSON(url string, v interface{}) error {
-	resp, err := httpClient.Get(url)
+	return httpGetJSONContext(context.Background(), url, v)
+}
+
+// httpGetJSONContext is httpGetJSON cancelled with ctx
+func httpGetJSONContext(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
 	err = json.NewDecoder(resp.Body).Decode(&v)
 	if err != nil {
 		return err
@@ -25,6 +59,99 @@ func httpGetJSON(url string, v interface{}) error {
 	return nil
 }
 
+// jsonPath looks up a number in a decoded json document.
+// The path is a dot separated list of object keys and array indexes, e.g. data.0.price
+func jsonPath(v interface{}, p string) (float64, error) {
+	for _, key := range strings.Split(p, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return 0, fmt.Errorf("%s: key %q not found", p, key)
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return 0, fmt.Errorf("%s: invalid index %q", p, key)
+			}
+			v = node[i]
+		default:
+			return 0, fmt.Errorf("%s: cannot look up %q", p, key)
+		}
+	}
+
+	switch value := v.(type) {
+	case float64:
+		return value, nil
+	case string:
+		return strconv.ParseFloat(value, 64)
+	}
+	return 0, fmt.Errorf("%s: not a number", p)
+}
+
+// configPath returns the path of a config file in the user config directory
+func configPath(name string) string {
+	userConfigDir, _ := os.UserConfigDir()
+	configDir := path.Join(userConfigDir, "crypto-price")
+	os.MkdirAll(configDir, 0755)
+	return path.Join(configDir, name)
+}
+
+// parseCandle parses the prices of a kline starting at start
+func parseCandle(start time.Time, open, high, low, close string) (Candle, error) {
+	candle := Candle{Start: start}
+	values := []struct {
+		value *float64
+		s     string
+	}{
+		{&candle.Open, open},
+		{&candle.High, high},
+		{&candle.Low, low},
+		{&candle.Close, close},
+	}
+	for _, v := range values {
+		var err error
+		*v.value, err = strconv.ParseFloat(v.s, 64)
+		if err != nil {
+			return Candle{}, err
+		}
+	}
+	return candle, nil
+}
+
+// parseVolume parses the base and quote volume of a kline into the candle
+func parseVolume(candle *Candle, volume, quoteVolume string) error {
+	var err error
+	candle.Volume, err = strconv.ParseFloat(volume, 64)
+	if err != nil {
+		return err
+	}
+	candle.QuoteVolume, err = strconv.ParseFloat(quoteVolume, 64)
+	return err
+}
+
+// sleep pauses for the duration d. It returns false when ctx is done before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// send sends a market update unless ctx is done before. It returns false when the update was not sent.
+// The aggregator stops reading the updates of an exchange once its Start returned.
+func send(ctx context.Context, update chan<- Market, market Market) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case update <- market:
+		return true
+	}
+}
+
 func runEvery(ctx context.Context, d time.Duration, f func()) {
 	go func() {
 		for {
@@ -39,25 +166,3 @@ func runEvery(ctx context.Context, d time.Duration, f func()) {
 		}
 	}()
 }
-
-func HasInternetConnection() bool {
-	// List of reliable IP:port targets (TCP)
-	targets := []string{
-		"8.8.8.8:53",        // Google DNS
-		"1.1.1.1:53",        // Cloudflare DNS
-		"9.9.9.9:53",        // Quad9 DNS
-		"208.67.222.222:53", // OpenDNS
-		"8.8.4.4:53",        // Google secondary
-	}
-
-	rand.Seed(time.Now().UnixNano())
-	target := targets[rand.Intn(len(targets))]
-
-	timeout := 500 * time.Millisecond
-	conn, err := net.DialTimeout("tcp", target, timeout)
-	if err != nil {
-		return false
-	}
-	_ = conn.Close()
-	return true
-}
@@ -0,0 +1,169 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn wraps a websocket connection so it can be written from multiple goroutines
+type wsConn struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func dialWebsocket(ctx context.Context, url string) (*wsConn, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &wsConn{conn: conn}, nil
+}
+
+func (c *wsConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+func (c *wsConn) WriteText(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(text))
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+// Serve reads messages until the connection fails, the handler returns an error or ctx is done.
+// The connection is closed when Serve returns.
+func (c *wsConn) Serve(ctx context.Context, handler func(msg []byte) error) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		c.conn.Close()
+	}()
+
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		err = handler(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// KeepAlive calls ping periodically until ctx is done or ping fails
+func (c *wsConn) KeepAlive(ctx context.Context, every time.Duration, ping func() error) {
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ping(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// wsMarkets is the market list of a websocket exchange.
+// Markets can be added and removed while the exchange is connected.
+type wsMarkets struct {
+	mu      sync.Mutex
+	markets []*Market
+	conn    *wsConn
+	ctx     context.Context // context of the connection
+	update  chan<- Market   // updates of the connected exchange
+}
+
+func (w *wsMarkets) list() []*Market {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*Market(nil), w.markets...)
+}
+
+// connect subscribes all markets on the connection with the message returned by subscribe.
+// The markets added later send their first update to update until ctx is done.
+func (w *wsMarkets) connect(ctx context.Context, conn *wsConn, update chan<- Market, subscribe func(markets []*Market) interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn = conn
+	w.ctx = ctx
+	w.update = update
+	return conn.WriteJSON(subscribe(w.markets))
+}
+
+func (w *wsMarkets) disconnect() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn = nil
+	w.ctx = nil
+	w.update = nil
+}
+
+// connContext returns the context of the connection, or the background context when not connected
+func (w *wsMarkets) connContext() context.Context {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ctx == nil {
+		return context.Background()
+	}
+	return w.ctx
+}
+
+// add adds a market and subscribes it when connected.
+// The fetched state of the market is sent as its first update, the stream may be quiet for a while.
+func (w *wsMarkets) add(market *Market, subscribe func(markets []*Market) interface{}) error {
+	w.mu.Lock()
+	w.markets = append(w.markets, market)
+	if w.conn == nil {
+		w.mu.Unlock()
+		return nil
+	}
+	first := market.Snapshot()
+	ctx, update := w.ctx, w.update
+	err := w.conn.WriteJSON(subscribe([]*Market{market}))
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	send(ctx, update, first)
+	return nil
+}
+
+// remove removes a market and unsubscribes it when connected
+func (w *wsMarkets) remove(base, quote string, unsubscribe func(markets []*Market) interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, market := range w.markets {
+		if market.Base == base && market.Quote == quote {
+			// copy, so the lists returned earlier are not modified
+			w.markets = append(w.markets[:i:i], w.markets[i+1:]...)
+			if w.conn == nil {
+				return nil
+			}
+			return w.conn.WriteJSON(unsubscribe([]*Market{market}))
+		}
+	}
+	return fmt.Errorf("market %s-%s not found", base, quote)
+}
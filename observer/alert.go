@@ -24,11 +24,43 @@ type alertDefinition struct {
 	Condition   string    `json:"condition"`
 	Value       []float64 `json:"value"`
 	Cmd         string    `json:"cmd"`
+
+	volume volumeSample // volume of the market at the last volume_spike check
+}
+
+// volumeSample is the volume of the reference candle of a market at a time
+type volumeSample struct {
+	time   time.Time
+	start  time.Time // start of the candle
+	volume float64
+}
+
+// volumeSpike reports whether the volume of the last minute is factor times the average volume per minute of the reference period.
+// It is checked at most once a minute.
+func (alert *alertDefinition) volumeSpike(candle exchange.Candle, factor float64) bool {
+	now := time.Now()
+	sample := alert.volume
+	if sample.time.IsZero() || !sample.start.Equal(candle.Start) || candle.Volume < sample.volume {
+		alert.volume = volumeSample{time: now, start: candle.Start, volume: candle.Volume}
+		return false
+	}
+	if now.Sub(sample.time) < time.Minute {
+		return false
+	}
+	alert.volume = volumeSample{time: now, start: candle.Start, volume: candle.Volume}
+
+	elapsed := now.Sub(candle.Start).Minutes()
+	if elapsed < 1 || candle.Volume == 0 {
+		return false
+	}
+	recent := (candle.Volume - sample.volume) / now.Sub(sample.time).Minutes()
+	return recent > factor*candle.Volume/elapsed
 }
 
 type MarketAlerter struct {
-	alerts []*alertDefinition
-	log    *logrus.Entry
+	alerts  []*alertDefinition
+	watcher *fsnotify.Watcher
+	log     *logrus.Entry
 }
 
 func NewMarketAlerter() (*MarketAlerter, error) {
@@ -42,44 +74,48 @@ func NewMarketAlerter() (*MarketAlerter, error) {
 		return nil, err
 	}
 
+	alerter.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		alerter.log.WithError(err).Error("failed to create file watcher, not watching for changes")
+		return alerter, nil
+	}
+	err = alerter.watcher.Add(alerter.configPath())
+	if err != nil {
+		alerter.log.WithError(err).Error("failed to add file watcher for alerts config file")
+	}
+
 	go alerter.watchConfigFile()
 	return alerter, nil
 }
 
+// watchConfigFile reloads the alerts on change until the watcher is closed
 func (j *MarketAlerter) watchConfigFile() {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		j.log.WithError(err).Error("failed to create file watcher, not watching for changes")
-	}
-	defer watcher.Close()
-
-	done := make(chan bool)
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					// File modified, reload alerts
-					j.load()
-				}
+	for {
+		select {
+		case event, ok := <-j.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				// File modified, reload alerts
+				j.load()
+			}
 
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				j.log.WithError(err).Error("error watching alerts config file")
+		case err, ok := <-j.watcher.Errors:
+			if !ok {
+				return
 			}
+			j.log.WithError(err).Error("error watching alerts config file")
 		}
-	}()
+	}
+}
 
-	err = watcher.Add(j.configPath())
-	if err != nil {
-		j.log.WithError(err).Error("failed to add file watcher for alerts config file")
+// Close stops watching the alerts config file
+func (j *MarketAlerter) Close() error {
+	if j.watcher == nil {
+		return nil
 	}
-	<-done
+	return j.watcher.Close()
 }
 
 func (j *MarketAlerter) configPath() string {
@@ -154,6 +190,22 @@ func (j *MarketAlerter) Update(info exchange.MarketDisplayInfo) {
 				if market.Candle.Close < alert.Value[0] {
 					j.triggerAlertCmd(alert)
 				}
+			case "gt_quote_volume":
+				if market.Candle.QuoteVolume > alert.Value[0] {
+					j.triggerAlertCmd(alert)
+				}
+			case "volume_spike":
+				if alert.volumeSpike(market.Candle, alert.Value[0]) {
+					j.triggerAlertCmd(alert)
+				}
+			case "gt_funding":
+				if market.IsFutures() && market.Futures.FundingRatePercent() > alert.Value[0] {
+					j.triggerAlertCmd(alert)
+				}
+			case "lt_funding":
+				if market.IsFutures() && market.Futures.FundingRatePercent() < alert.Value[0] {
+					j.triggerAlertCmd(alert)
+				}
 			}
 		}
 	}
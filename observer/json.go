@@ -3,6 +3,7 @@ package observer
 import (
 	"encoding/json"
 	"io"
+	"math"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -17,13 +18,54 @@ type jsonCandle struct {
 	Low     float64 `json:"low"`
 	Percent float64 `json:"percent"`
 	Color   string  `json:"color"`
+	// volumes of the reference period, omitted when the exchange does not serve them
+	Volume      float64 `json:"volume,omitempty"`
+	QuoteVolume float64 `json:"quote_volume,omitempty"`
+	Period      string  `json:"period,omitempty"` // reference period of the percent, e.g. "day Europe/Berlin"
+	Start       int64   `json:"start,omitempty"`
+}
+
+type jsonFutures struct {
+	MarkPrice       float64 `json:"mark_price"`
+	IndexPrice      float64 `json:"index_price"`
+	FundingRate     float64 `json:"funding_rate"`
+	NextFundingTime int64   `json:"next_funding_time"`
+}
+
+type jsonBook struct {
+	Bid       float64 `json:"bid"`
+	BidQty    float64 `json:"bid_qty"`
+	Ask       float64 `json:"ask"`
+	AskQty    float64 `json:"ask_qty"`
+	SpreadBps float64 `json:"spread_bps"`
+}
+
+type jsonTimeframe struct {
+	Name        string  `json:"name"`
+	Open        float64 `json:"open"`
+	High        float64 `json:"high"`
+	Low         float64 `json:"low"`
+	Percent     float64 `json:"percent"`
+	Volume      float64 `json:"volume,omitempty"`
+	QuoteVolume float64 `json:"quote_volume,omitempty"`
+}
+
+type jsonStatus struct {
+	State   string `json:"state"`
+	Since   int64  `json:"since,omitempty"`    // unix milliseconds, omitted before the first connection event
+	RetryIn int64  `json:"retry_in,omitempty"` // seconds until the next connection attempt
+	Error   string `json:"error,omitempty"`
 }
 
 type jsonChart struct {
-	Exchange string     `json:"exchange"`
-	Base     string     `json:"base"`
-	Quote    string     `json:"quote"`
-	Candle   jsonCandle `json:"candle"`
+	Exchange   string          `json:"exchange"`
+	Base       string          `json:"base"`
+	Quote      string          `json:"quote"`
+	Candle     jsonCandle      `json:"candle"`
+	Futures    *jsonFutures    `json:"futures,omitempty"`
+	Book       *jsonBook       `json:"book,omitempty"`
+	Timeframes []jsonTimeframe `json:"timeframes,omitempty"`
+	Status     jsonStatus      `json:"status"`
 }
 
 type JSONOutput struct {
@@ -40,18 +82,76 @@ func NewJSONOutput() *JSONOutput {
 }
 
 func (j *JSONOutput) toJSONStruct(info exchange.MarketDisplayInfo) jsonChart {
+	var futures *jsonFutures
+	if info.Market.IsFutures() {
+		futures = &jsonFutures{
+			MarkPrice:       info.Market.Futures.MarkPrice,
+			IndexPrice:      info.Market.Futures.IndexPrice,
+			FundingRate:     info.Market.Futures.FundingRate,
+			NextFundingTime: info.Market.Futures.NextFundingTime.UnixMilli(),
+		}
+	}
+
+	var book *jsonBook
+	if info.Market.HasBook() {
+		book = &jsonBook{
+			Bid:       info.Market.Book.Bid,
+			BidQty:    info.Market.Book.BidQty,
+			Ask:       info.Market.Book.Ask,
+			AskQty:    info.Market.Book.AskQty,
+			SpreadBps: info.Market.Book.SpreadBps(),
+		}
+	}
+
+	var timeframes []jsonTimeframe
+	for _, timeframe := range info.Market.Timeframes {
+		timeframes = append(timeframes, jsonTimeframe{
+			Name:        timeframe.Name,
+			Open:        timeframe.Open,
+			High:        timeframe.High,
+			Low:         timeframe.Low,
+			Percent:     timeframe.Percent(),
+			Volume:      timeframe.Volume,
+			QuoteVolume: timeframe.QuoteVolume,
+		})
+	}
+
+	var start int64
+	if !info.Market.Candle.Start.IsZero() {
+		start = info.Market.Candle.Start.UnixMilli()
+	}
+
+	status := jsonStatus{
+		State:   info.Connection.State.String(),
+		RetryIn: int64(math.Ceil(info.Connection.RetryIn().Seconds())),
+	}
+	if !info.Connection.Time.IsZero() {
+		status.Since = info.Connection.Time.UnixMilli()
+	}
+	if info.Connection.Err != nil {
+		status.Error = info.Connection.Err.Error()
+	}
+
 	return jsonChart{
 		Exchange: info.Market.Exchange,
 		Base:     info.Market.Base,
 		Quote:    info.Market.Quote,
 		Candle: jsonCandle{
-			High:    info.Market.Candle.High,
-			Open:    info.Market.Candle.Open,
-			Close:   info.Market.Candle.Close,
-			Low:     info.Market.Candle.Low,
-			Percent: info.Market.Candle.Percent(),
-			Color:   getInterpolatedColorFor(info.Market.Candle).Hex(),
+			High:        info.Market.Candle.High,
+			Open:        info.Market.Candle.Open,
+			Close:       info.Market.Candle.Close,
+			Low:         info.Market.Candle.Low,
+			Percent:     info.Market.Candle.Percent(),
+			Color:       getInterpolatedColorFor(info.Market.Candle).Hex(),
+			Period:      info.Market.Candle.Period.String(),
+			Start:       start,
+			Volume:      info.Market.Candle.Volume,
+			QuoteVolume: info.Market.Candle.QuoteVolume,
 		},
+		Futures:    futures,
+		Book:       book,
+		Timeframes: timeframes,
+		Status:     status,
 	}
 }
 
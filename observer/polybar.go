@@ -15,6 +15,10 @@ import (
 
 type PolybarConfig struct {
 	ShortOnlyOnWeekend bool
+	// Sparkline is the width of the price chart after the change, 0 hides it
+	Sparkline int
+	// SparklineWindow is the time covered by the price chart
+	SparklineWindow time.Duration
 }
 
 type PolybarOutput struct {
@@ -22,6 +26,7 @@ type PolybarOutput struct {
 	showPrice map[string]bool
 	config    PolybarConfig
 	keys      []string
+	server    *http.Server
 	log       *logrus.Entry
 }
 
@@ -31,6 +36,7 @@ func NewPolybarOutput(config PolybarConfig) *PolybarOutput {
 		showPrice: make(map[string]bool),
 		config:    config,
 		keys:      make([]string, 0),
+		server:    &http.Server{Addr: ":60253"},
 		log:       logrus.WithField("observer", "polybar"),
 	}
 
@@ -66,22 +72,27 @@ func (polybar *PolybarOutput) startConfigServer() {
 			default:
 				polybar.log.WithField("action", action).Error("Unknown action")
 			}
-				
+
 			polybar.Update(polybar.markets[market])
 
 		}
 	}
 
-	http.HandleFunc("/polybar", process)
-	port := ":60253"
-	polybar.log.WithField("port", port).Info("Starting config server")
-	err := http.ListenAndServe(port, nil)
-	if err != nil {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/polybar", process)
+	polybar.server.Handler = mux
+	polybar.log.WithField("port", polybar.server.Addr).Info("Starting config server")
+	err := polybar.server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		polybar.log.WithError(err).Error("Config server stopped")
-		return
 	}
 }
 
+// Close stops the config server
+func (polybar *PolybarOutput) Close() error {
+	return polybar.server.Close()
+}
+
 func (polybar *PolybarOutput) formatQuote(market exchange.Market) string {
 	if strings.EqualFold(market.Quote, "btc") {
 		// return "Ƀ"
@@ -114,6 +125,24 @@ func (polybar *PolybarOutput) tooglePrice(market, data string) string {
 	return b.String()
 }
 
+// Remove drops a removed market from the output
+func (polybar *PolybarOutput) Remove(key string) {
+	delete(polybar.markets, key)
+	delete(polybar.showPrice, key)
+	for i, k := range polybar.keys {
+		if k == key {
+			polybar.keys = append(polybar.keys[:i], polybar.keys[i+1:]...)
+			break
+		}
+	}
+	polybar.render()
+}
+
+// WantsHistory is true when the price chart is shown
+func (polybar *PolybarOutput) WantsHistory() bool {
+	return polybar.config.Sparkline > 0
+}
+
 func (polybar *PolybarOutput) Update(info exchange.MarketDisplayInfo) {
 	market := info.Market
 
@@ -131,7 +160,11 @@ func (polybar *PolybarOutput) Update(info exchange.MarketDisplayInfo) {
 		polybar.showPrice[key] = false
 	}
 
-	// format all market
+	polybar.render()
+}
+
+// render prints all market in one line
+func (polybar *PolybarOutput) render() {
 	builder := strings.Builder{}
 	for _, k := range polybar.keys {
 		info := polybar.markets[k]
@@ -143,12 +176,19 @@ func (polybar *PolybarOutput) Update(info exchange.MarketDisplayInfo) {
 		builder.WriteString(getInterpolatedColorFor(info.Market.Candle).Hex())
 		builder.WriteString("}")
 
-		builder.WriteString(polybar.tooglePrice(k, strings.ToUpper(market.Base)))
+		builder.WriteString(polybar.tooglePrice(k, strings.ToUpper(info.Market.Base)))
 		if showPrice, ok := polybar.showPrice[k]; !ok || showPrice {
 			builder.WriteString(": ")
 			builder.WriteString(quote)
 			builder.WriteString(price)
-			builder.WriteString(fmt.Sprintf(" (%+.1f%%) ", market.Candle.Percent()))
+			builder.WriteString(fmt.Sprintf(" (%+.1f%%) ", info.Market.Candle.Percent()))
+			if info.Market.HasBook() {
+				builder.WriteString(fmt.Sprintf("%.1fbps ", info.Market.Book.SpreadBps()))
+			}
+			if chart := sparkline(exchange.RecentHistory(info.History, polybar.config.SparklineWindow), polybar.config.Sparkline); chart != "" {
+				builder.WriteString(chart)
+				builder.WriteString(" ")
+			}
 		} else {
 			builder.WriteString(" ")
 		}
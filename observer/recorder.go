@@ -0,0 +1,64 @@
+package observer
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/u3mur4/crypto-price/exchange"
+	"github.com/u3mur4/crypto-price/internal/logger"
+)
+
+// Recorder writes every market update to a newline delimited json file which can be replayed with the replay exchange
+type Recorder struct {
+	file     *os.File
+	encoder  *json.Encoder
+	log      *logrus.Entry
+	recorded map[string]time.Time // market key - last update of the last recorded update
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		file:     f,
+		encoder:  json.NewEncoder(f),
+		log:      logger.Log().WithField("observer", "recorder"),
+		recorded: make(map[string]time.Time),
+	}, nil
+}
+
+func (r *Recorder) Update(info exchange.MarketDisplayInfo) {
+	r.UpdateRaw(info)
+}
+
+// UpdateRaw records the update as the exchange sent it, so a replay applies the options like --satoshi only once.
+// The heartbeats and the connection changes repeat the last update of the market, they are not recorded.
+func (r *Recorder) UpdateRaw(info exchange.MarketDisplayInfo) {
+	key := info.Market.Key()
+	if last, ok := r.recorded[key]; ok && last.Equal(info.Market.LastUpdate) {
+		return
+	}
+	r.recorded[key] = info.Market.LastUpdate
+
+	err := r.encoder.Encode(exchange.RecordedUpdate{
+		Time: time.Now(),
+		Info: info,
+	})
+	if err != nil {
+		r.log.WithError(err).Error("failed to record market update")
+	}
+}
+
+// Remove forgets the last update of a removed market, an update of the market added again is recorded
+func (r *Recorder) Remove(key string) {
+	delete(r.recorded, key)
+}
+
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
@@ -1,8 +1,12 @@
 package observer
 
 import (
+	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -10,34 +14,95 @@ import (
 	"github.com/u3mur4/crypto-price/internal/logger"
 )
 
+// MarketController adds and removes markets at runtime
+type MarketController interface {
+	AddMarket(format string) error
+	RemoveMarket(key string) error
+}
+
+// OrderBookProvider is implemented by controllers which serve the order book depth of the markets
+// registered with the depth option. The key format is exchange:base-quote.
+type OrderBookProvider interface {
+	OrderBook(key string, levels int) (exchange.OrderBookDepth, error)
+}
+
+// defaultDepthLevels is the number of price levels per side returned when the levels parameter is missing
+const defaultDepthLevels = 10
+
+type jsonOrderBookLevel struct {
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"`
+}
+
+type jsonDepthBand struct {
+	Percent     float64 `json:"percent"`
+	BidQuantity float64 `json:"bid_quantity"`
+	BidNotional float64 `json:"bid_notional"`
+	AskQuantity float64 `json:"ask_quantity"`
+	AskNotional float64 `json:"ask_notional"`
+	Partial     bool    `json:"partial,omitempty"` // the book ends within the band, the depth is a lower bound
+}
+
+type jsonOrderBookDepth struct {
+	Market   string               `json:"market"`
+	Mid      float64              `json:"mid"`
+	Bids     []jsonOrderBookLevel `json:"bids"`
+	Asks     []jsonOrderBookLevel `json:"asks"`
+	Bands    []jsonDepthBand      `json:"bands"`
+	UpdateID int64                `json:"update_id"`
+	Time     int64                `json:"time"`
+}
+
 type MarketAPIServer struct {
 	markets    map[string]exchange.MarketDisplayInfo
-	jsonOutput *JSONOutput
+	mu         sync.Mutex
+	controller MarketController
+	server     *http.Server
 	log        *logrus.Entry
 }
 
-func NewMarketAPIServer() *MarketAPIServer {
+// NewMarketAPIServer serves the market infos and the market control api.
+// The control api is disabled when controller is nil, the depth api when it does not implement OrderBookProvider.
+func NewMarketAPIServer(controller MarketController) *MarketAPIServer {
 	server := &MarketAPIServer{
 		markets:    make(map[string]exchange.MarketDisplayInfo),
-		jsonOutput: NewJSONOutput(),
+		controller: controller,
 		log:        logger.Log().WithField("observer", "market_api_server"),
 	}
 
 	rtr := mux.NewRouter()
-	rtr.HandleFunc("/{key:.*}", server.handler).Methods("GET")
+	rtr.HandleFunc("/api/markets", server.listHandler).Methods("GET")
+	rtr.HandleFunc("/api/markets", server.addHandler).Methods("POST")
+	rtr.HandleFunc("/api/markets/{key}", server.removeHandler).Methods("DELETE")
+	rtr.HandleFunc("/api/markets/{key}/depth", server.depthHandler).Methods("GET")
+	rtr.HandleFunc("/api/{key}", server.handler).Methods("GET")
 
-	http.Handle("/api", rtr)
-	go http.ListenAndServe(":23232", nil)
+	server.server = &http.Server{Addr: ":23232", Handler: rtr}
+	go func() {
+		err := server.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			server.log.WithError(err).Error("api server stopped")
+		}
+	}()
 
 	return server
 }
 
+// Close stops the api server
+func (j *MarketAPIServer) Close() error {
+	return j.server.Close()
+}
+
 func (j *MarketAPIServer) handler(w http.ResponseWriter, r *http.Request) {
-	key := strings.ToLower(r.URL.Path[1:])
-	if chart, ok := j.markets[key]; ok {
+	key := strings.ToLower(mux.Vars(r)["key"])
+	j.mu.Lock()
+	chart, ok := j.markets[key]
+	j.mu.Unlock()
+	if ok {
 		w.Header().Set("Content-Type", "application/json")
-		j.jsonOutput.Output = w
-		j.jsonOutput.Update(chart)
+		jsonOutput := NewJSONOutput()
+		jsonOutput.Output = w
+		jsonOutput.Update(chart)
 		j.log.WithField("key", key).Debug("GET request for market info")
 	} else {
 		j.log.WithField("key", key).Warn("Market not found")
@@ -45,6 +110,126 @@ func (j *MarketAPIServer) handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (j *MarketAPIServer) listHandler(w http.ResponseWriter, r *http.Request) {
+	j.mu.Lock()
+	keys := make([]string, 0, len(j.markets))
+	for key := range j.markets {
+		keys = append(keys, key)
+	}
+	j.mu.Unlock()
+	sort.Strings(keys)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (j *MarketAPIServer) addHandler(w http.ResponseWriter, r *http.Request) {
+	if j.controller == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	market := r.FormValue("market")
+	err := j.controller.AddMarket(market)
+	if err != nil {
+		j.log.WithError(err).WithField("market", market).Warn("cannot add market")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	j.log.WithField("market", market).Info("market added")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (j *MarketAPIServer) removeHandler(w http.ResponseWriter, r *http.Request) {
+	if j.controller == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	key := strings.ToLower(mux.Vars(r)["key"])
+	err := j.controller.RemoveMarket(key)
+	if err != nil {
+		j.log.WithError(err).WithField("key", key).Warn("cannot remove market")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	j.log.WithField("key", key).Info("market removed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (j *MarketAPIServer) depthHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := j.controller.(OrderBookProvider)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	levels := defaultDepthLevels
+	if v := r.URL.Query().Get("levels"); v != "" {
+		var err error
+		levels, err = strconv.Atoi(v)
+		if err != nil || levels <= 0 {
+			http.Error(w, "levels must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	key := strings.ToLower(mux.Vars(r)["key"])
+	depth, err := provider.OrderBook(key, levels)
+	if err != nil {
+		j.log.WithError(err).WithField("key", key).Warn("cannot get order book")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toJSONOrderBookDepth(key, depth))
+}
+
+func toJSONOrderBookDepth(key string, depth exchange.OrderBookDepth) jsonOrderBookDepth {
+	levels := func(levels []exchange.OrderBookLevel) []jsonOrderBookLevel {
+		converted := make([]jsonOrderBookLevel, 0, len(levels))
+		for _, level := range levels {
+			converted = append(converted, jsonOrderBookLevel{Price: level.Price, Quantity: level.Quantity})
+		}
+		return converted
+	}
+
+	bands := make([]jsonDepthBand, 0, len(depth.Bands))
+	for _, band := range depth.Bands {
+		bands = append(bands, jsonDepthBand{
+			Percent:     band.Percent,
+			BidQuantity: band.BidQuantity,
+			BidNotional: band.BidNotional,
+			AskQuantity: band.AskQuantity,
+			AskNotional: band.AskNotional,
+			Partial:     band.Partial,
+		})
+	}
+
+	return jsonOrderBookDepth{
+		Market:   key,
+		Mid:      depth.Mid,
+		Bids:     levels(depth.Bids),
+		Asks:     levels(depth.Asks),
+		Bands:    bands,
+		UpdateID: depth.UpdateID,
+		Time:     depth.Time.UnixMilli(),
+	}
+}
+
 func (j *MarketAPIServer) Update(info exchange.MarketDisplayInfo) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
 	j.markets[info.Market.Key()] = info
 }
+
+func (j *MarketAPIServer) Remove(key string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.markets, key)
+}
@@ -0,0 +1,46 @@
+package observer
+
+import (
+	"math"
+	"strings"
+
+	"github.com/u3mur4/crypto-price/exchange"
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the prices with block characters, at most width characters.
+// Longer histories are split into width buckets, each drawn with its last price.
+func sparkline(history []exchange.PricePoint, width int) string {
+	if width <= 0 || len(history) == 0 {
+		return ""
+	}
+
+	prices := make([]float64, 0, width)
+	if len(history) <= width {
+		for _, point := range history {
+			prices = append(prices, point.Price)
+		}
+	} else {
+		for i := 1; i <= width; i++ {
+			prices = append(prices, history[i*len(history)/width-1].Price)
+		}
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, price := range prices {
+		min = math.Min(min, price)
+		max = math.Max(max, price)
+	}
+
+	b := strings.Builder{}
+	for _, price := range prices {
+		// a flat line is drawn in the middle
+		level := len(sparkBlocks) / 2
+		if max > min {
+			level = int((price - min) / (max - min) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
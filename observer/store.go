@@ -0,0 +1,294 @@
+package observer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/u3mur4/crypto-price/exchange"
+	"github.com/u3mur4/crypto-price/internal/logger"
+)
+
+// storeInterval is the length of the stored candles, the exchange.UTCMinute period built by the aggregator
+const storeInterval = time.Minute
+
+// storedCandle is a line of a segment file
+type storedCandle struct {
+	Time  int64   `json:"t"` // unix time of the start of the minute
+	Open  float64 `json:"o"`
+	High  float64 `json:"h"`
+	Low   float64 `json:"l"`
+	Close float64 `json:"c"`
+	// Volume and QuoteVolume are omitted when the exchange does not serve them
+	Volume      float64 `json:"v,omitempty"`
+	QuoteVolume float64 `json:"q,omitempty"`
+}
+
+// CandleStore appends the 1m candles of every market to disk, one newline delimited json segment per market and UTC day:
+// <dir>/<exchange>/<base>-<quote>/2006-01-02.jsonl
+type CandleStore struct {
+	dir       string
+	retention time.Duration
+	current   map[string]exchange.Candle // market key - 1m candle of the current minute, stored when it completes
+	pruned    time.Time                  // day of the last retention check
+	mu        sync.Mutex                 // guards current and the segment files
+	log       *logrus.Entry
+}
+
+// DefaultStoreDir returns the history directory under the user data dir, $XDG_DATA_HOME or ~/.local/share
+func DefaultStoreDir() string {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, _ := os.UserHomeDir()
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "crypto-price", "history")
+}
+
+// NewCandleStore stores the candles in dir and deletes the segments older than retention. 0 keeps every segment.
+func NewCandleStore(dir string, retention time.Duration) (*CandleStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &CandleStore{
+		dir:       dir,
+		retention: retention,
+		current:   make(map[string]exchange.Candle),
+		log:       logger.Log().WithField("observer", "store"),
+	}
+	store.prune(time.Now())
+	return store, nil
+}
+
+// marketDir returns the directory of the segments of a market key in exchange:base-quote format
+func (s *CandleStore) marketDir(key string) (string, error) {
+	exchangeName, marketName, ok := strings.Cut(strings.ToLower(key), ":")
+	if !ok {
+		return "", fmt.Errorf("invalid market key %q", key)
+	}
+	return filepath.Join(s.dir, url.PathEscape(exchangeName), url.PathEscape(marketName)), nil
+}
+
+// Update keeps the current 1m candle of the market, it is stored on Remove and Close
+func (s *CandleStore) Update(info exchange.MarketDisplayInfo) {
+	// a replay would be stored at the time of the replay
+	if info.Market.Replayed {
+		return
+	}
+	for _, candle := range info.Candles {
+		if candle.Period == exchange.UTCMinute {
+			s.mu.Lock()
+			s.current[info.Market.Key()] = candle
+			s.mu.Unlock()
+		}
+	}
+}
+
+// CandleCompleted stores a completed 1m candle
+func (s *CandleStore) CandleCompleted(market exchange.Market, candle exchange.Candle) {
+	if market.Replayed || candle.Period != exchange.UTCMinute {
+		return
+	}
+	key := market.Key()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.append(key, candle)
+	if err != nil {
+		s.log.WithError(err).WithField("market", key).Error("failed to store candle")
+	}
+	if s.current[key].Start.Equal(candle.Start) {
+		delete(s.current, key)
+	}
+
+	if now := time.Now(); now.Truncate(24 * time.Hour).After(s.pruned) {
+		s.prune(now)
+	}
+}
+
+// append writes a finished candle to the segment of its day. Must be called with mu held.
+func (s *CandleStore) append(key string, candle exchange.Candle) error {
+	dir, err := s.marketDir(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(candle.Start)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(storedCandle{
+		Time:        candle.Start.Unix(),
+		Open:        candle.Open,
+		High:        candle.High,
+		Low:         candle.Low,
+		Close:       candle.Close,
+		Volume:      candle.Volume,
+		QuoteVolume: candle.QuoteVolume,
+	})
+}
+
+// segmentName returns the file name of the segment containing t
+func segmentName(t time.Time) string {
+	return t.UTC().Format("2006-01-02") + ".jsonl"
+}
+
+// prune deletes the segments which ended before the retention. Must be called with mu held.
+func (s *CandleStore) prune(now time.Time) {
+	s.pruned = now.Truncate(24 * time.Hour)
+	if s.retention <= 0 {
+		return
+	}
+
+	segments, err := filepath.Glob(filepath.Join(s.dir, "*", "*", "*.jsonl"))
+	if err != nil {
+		return
+	}
+	for _, segment := range segments {
+		day, err := time.Parse("2006-01-02", strings.TrimSuffix(filepath.Base(segment), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		if day.Add(24 * time.Hour).Before(now.Add(-s.retention)) {
+			err = os.Remove(segment)
+			if err != nil {
+				s.log.WithError(err).WithField("segment", segment).Error("failed to delete segment")
+			}
+		}
+	}
+}
+
+// History returns the stored candles of a market key in exchange:base-quote format between from and to, oldest first.
+// The 1m candles are merged into candles of interval, e.g. 1h candles starting at the full hours.
+func (s *CandleStore) History(key string, from, to time.Time, interval time.Duration) ([]exchange.Candle, error) {
+	if interval < storeInterval || interval%storeInterval != 0 {
+		return nil, fmt.Errorf("interval must be a multiple of %s", storeInterval)
+	}
+	dir, err := s.marketDir(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	minutes := make(map[int64]exchange.Candle)
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.Add(24 * time.Hour) {
+		err := readSegment(filepath.Join(dir, segmentName(day)), minutes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if candle, ok := s.current[strings.ToLower(key)]; ok {
+		mergeMinute(minutes, candle)
+	}
+
+	starts := make([]int64, 0, len(minutes))
+	for start := range minutes {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	candles := make([]exchange.Candle, 0)
+	for _, start := range starts {
+		minute := minutes[start]
+		if minute.Start.Before(from) || minute.Start.After(to) {
+			continue
+		}
+
+		bucket := minute.Start.Truncate(interval)
+		if len(candles) == 0 || !candles[len(candles)-1].Start.Equal(bucket) {
+			candles = append(candles, exchange.Candle{Start: bucket, Open: minute.Open})
+		}
+		candles[len(candles)-1].Merge(minute)
+	}
+	return candles, nil
+}
+
+// readSegment reads the candles of a segment into minutes. A missing segment has no candles.
+func readSegment(path string, minutes map[int64]exchange.Candle) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var stored storedCandle
+		// skip the lines broken by a crash
+		if json.Unmarshal(scanner.Bytes(), &stored) != nil {
+			continue
+		}
+		mergeMinute(minutes, exchange.Candle{
+			Start:       time.Unix(stored.Time, 0),
+			Open:        stored.Open,
+			High:        stored.High,
+			Low:         stored.Low,
+			Close:       stored.Close,
+			Volume:      stored.Volume,
+			QuoteVolume: stored.QuoteVolume,
+		})
+	}
+	return scanner.Err()
+}
+
+// mergeMinute adds a 1m candle to minutes. A minute stored twice, e.g. around a restart, is merged.
+func mergeMinute(minutes map[int64]exchange.Candle, candle exchange.Candle) {
+	existing, ok := minutes[candle.Start.Unix()]
+	if !ok {
+		minutes[candle.Start.Unix()] = candle
+		return
+	}
+	existing.Merge(candle)
+	minutes[candle.Start.Unix()] = existing
+}
+
+// Remove stores the candle of the current minute of a removed market
+func (s *CandleStore) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if candle, ok := s.current[key]; ok {
+		err := s.append(key, candle)
+		if err != nil {
+			s.log.WithError(err).WithField("market", key).Error("failed to store candle")
+		}
+		delete(s.current, key)
+	}
+}
+
+// Close stores the candles of the current minute
+func (s *CandleStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, candle := range s.current {
+		err := s.append(key, candle)
+		if err != nil {
+			return err
+		}
+	}
+	s.current = make(map[string]exchange.Candle)
+	return nil
+}
@@ -3,6 +3,8 @@ package observer
 import (
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/template"
 	"github.com/u3mur4/crypto-price/exchange"
@@ -11,15 +13,40 @@ import (
 type TemplateOutput struct {
 	Output   io.Writer
 	Template *template.Template
+	history  bool // the template uses the price history
+}
+
+// templateData is the input of the template, the market fields and its price history
+type templateData struct {
+	exchange.Market
+	History []exchange.PricePoint
+}
+
+// templateFuncs are the functions usable in templates, e.g. {{sparkline (recent .History "1h") 12}}
+var templateFuncs = template.FuncMap{
+	"sparkline": sparkline,
+	"recent": func(history []exchange.PricePoint, window string) ([]exchange.PricePoint, error) {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, err
+		}
+		return exchange.RecentHistory(history, d), nil
+	},
 }
 
 func NewTemplateOutput(format string) TemplateOutput {
 	return TemplateOutput{
 		Output:   os.Stdout,
-		Template: template.Must(template.New("TemplateFormatter").Parse(format)),
+		Template: template.Must(template.New("TemplateFormatter").Funcs(templateFuncs).Parse(format)),
+		history:  strings.Contains(format, ".History"),
 	}
 }
 
+// WantsHistory is true when the template uses .History
+func (t TemplateOutput) WantsHistory() bool {
+	return t.history
+}
+
 func (t TemplateOutput) Update(info exchange.MarketDisplayInfo) {
-	t.Template.Execute(t.Output, info.Market)
+	t.Template.Execute(t.Output, templateData{Market: info.Market, History: info.History})
 }
@@ -1,10 +1,13 @@
 package observer
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +19,18 @@ import (
 
 type WaybarConfig struct {
 	ShortOnlyOnWeekend bool
+	// Sparkline is the width of the price chart after the change, 0 hides it
+	Sparkline int
+	// SparklineWindow is the time covered by the price chart
+	SparklineWindow time.Duration
+	// JSON prints {"text", "tooltip"} objects for modules with "return-type": "json"
+	JSON bool
+}
+
+// waybarJSON is the output of modules with "return-type": "json"
+type waybarJSON struct {
+	Text    string `json:"text"`
+	Tooltip string `json:"tooltip"`
 }
 
 type WaybarOutput struct {
@@ -24,6 +39,7 @@ type WaybarOutput struct {
 	showColor map[string]bool
 	config    WaybarConfig
 	keys      []string
+	server    *http.Server
 	log       *logrus.Entry
 }
 
@@ -34,6 +50,7 @@ func NewWaybarOutput(config WaybarConfig) *WaybarOutput {
 		showColor: make(map[string]bool),
 		config:    config,
 		keys:      make([]string, 0),
+		server:    &http.Server{Addr: ":60254"},
 		log:       logrus.WithField("observer", "waybar"),
 	}
 
@@ -56,7 +73,7 @@ func (waybar *WaybarOutput) startConfigServer() {
 				waybar.log.WithField("market", market).Error("Market not found")
 				return
 			}
-			
+
 			action := r.FormValue("action")
 
 			switch action {
@@ -84,15 +101,21 @@ func (waybar *WaybarOutput) startConfigServer() {
 		}
 	}
 
-	http.HandleFunc("/waybar", process)
-	port := ":60254"
-	waybar.log.WithField("port", port).Info("Starting config server")
-	err := http.ListenAndServe(port, nil)
-	if err != nil {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/waybar", process)
+	waybar.server.Handler = mux
+	waybar.log.WithField("port", waybar.server.Addr).Info("Starting config server")
+	err := waybar.server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		waybar.log.WithError(err).Error("Config server stopped")
 	}
 }
 
+// Close stops the config server
+func (waybar *WaybarOutput) Close() error {
+	return waybar.server.Close()
+}
+
 func (waybar *WaybarOutput) formatQuote(market exchange.Market) string {
 	if strings.EqualFold(market.Quote, "btc") {
 		// return "Ƀ"
@@ -115,6 +138,25 @@ func (waybar *WaybarOutput) formatPrice(market exchange.Market) string {
 	return fmt.Sprintf("%.3f", market.Candle.Close)
 }
 
+// Remove drops a removed market from the output
+func (waybar *WaybarOutput) Remove(key string) {
+	delete(waybar.markets, key)
+	delete(waybar.showPrice, key)
+	delete(waybar.showColor, key)
+	for i, k := range waybar.keys {
+		if k == key {
+			waybar.keys = append(waybar.keys[:i], waybar.keys[i+1:]...)
+			break
+		}
+	}
+	waybar.render()
+}
+
+// WantsHistory is true when the price chart is shown
+func (waybar *WaybarOutput) WantsHistory() bool {
+	return waybar.config.Sparkline > 0
+}
+
 func (waybar *WaybarOutput) Update(info exchange.MarketDisplayInfo) {
 	market := info.Market
 	key := market.Key()
@@ -131,14 +173,18 @@ func (waybar *WaybarOutput) Update(info exchange.MarketDisplayInfo) {
 		waybar.showPrice[key] = false
 	}
 
-	colorWithNetworkConnectionStatus := func(info exchange.MarketDisplayInfo) colorful.Color {
-		if time.Since(info.LastConfirmedConnectionTime) > time.Second*5 || time.Since(info.Market.LastUpdate) > time.Second*30 {
-			return colorful.Color{R: 0.5, G: 0.5, B: 0.5} // gray
-		}
-		return getInterpolatedColorFor(info.Market.Candle)
+	waybar.render()
+}
+
+func (waybar *WaybarOutput) colorWithNetworkConnectionStatus(info exchange.MarketDisplayInfo) colorful.Color {
+	if time.Since(info.LastConfirmedConnectionTime) > time.Second*5 || time.Since(info.Market.LastUpdate) > time.Second*30 {
+		return colorful.Color{R: 0.5, G: 0.5, B: 0.5} // gray
 	}
+	return getInterpolatedColorFor(info.Market.Candle)
+}
 
-	// format all market
+// render prints all market in one line
+func (waybar *WaybarOutput) render() {
 	builder := strings.Builder{}
 	for _, k := range waybar.keys {
 		info := waybar.markets[k]
@@ -149,7 +195,7 @@ func (waybar *WaybarOutput) Update(info exchange.MarketDisplayInfo) {
 
 		builder.WriteString("<span color='")
 		if showColor, ok := waybar.showColor[k]; !ok || showColor {
-			builder.WriteString(colorWithNetworkConnectionStatus(info).Hex())
+			builder.WriteString(waybar.colorWithNetworkConnectionStatus(info).Hex())
 		} else {
 			builder.WriteString("#FFFFFF")
 		}
@@ -162,13 +208,53 @@ func (waybar *WaybarOutput) Update(info exchange.MarketDisplayInfo) {
 			builder.WriteString(quote)
 			builder.WriteString(price)
 			builder.WriteString(fmt.Sprintf(" (%+.1f%%) ", market.Candle.Percent()))
+			if market.HasBook() {
+				builder.WriteString(fmt.Sprintf("%.1fbps ", market.Book.SpreadBps()))
+			}
+			if chart := sparkline(exchange.RecentHistory(info.History, waybar.config.SparklineWindow), waybar.config.Sparkline); chart != "" {
+				builder.WriteString(chart)
+				builder.WriteString(" ")
+			}
 		} else {
 			builder.WriteString(" ")
 		}
+		if info.Connection.State == exchange.Reconnecting {
+			builder.WriteString(fmt.Sprintf("reconnecting in %.0fs ", math.Ceil(info.Connection.RetryIn().Seconds())))
+		}
 
 		builder.WriteString("</span>")
 	}
 
+	if waybar.config.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		err := encoder.Encode(waybarJSON{
+			Text:    builder.String(),
+			Tooltip: waybar.tooltip(),
+		})
+		if err != nil {
+			waybar.log.WithError(err).Error("Failed to encode output")
+		}
+		return
+	}
+
 	builder.WriteString("\n")
 	io.Copy(os.Stdout, strings.NewReader(builder.String()))
 }
+
+// tooltip shows the timeframes of the markets, one market per line
+func (waybar *WaybarOutput) tooltip() string {
+	lines := make([]string, 0, len(waybar.keys))
+	for _, k := range waybar.keys {
+		market := waybar.markets[k].Market
+		line := strings.ToUpper(market.Base) + "/" + strings.ToUpper(market.Quote) + fmt.Sprintf(": %+.1f%% %s", market.Candle.Percent(), market.Candle.Period)
+		for _, timeframe := range market.Timeframes {
+			line += fmt.Sprintf(" / %+.1f%% %s", timeframe.Percent(), timeframe.Name)
+		}
+		if market.HasBook() {
+			line += fmt.Sprintf(" / bid %s ask %s", strconv.FormatFloat(market.Book.Bid, 'f', -1, 64), strconv.FormatFloat(market.Book.Ask, 'f', -1, 64))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}